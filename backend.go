@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// store backends
+const (
+	BackendBolt   = "bolt"
+	BackendSqlite = "sqlite"
+)
+
+// Store keeps records by key in buckets, buckets are created when first written
+type Store interface {
+	// View runs fn in a read only transaction
+	View(fn func(tx *Tx) error) error
+	// Update runs fn in a read write transaction, which is rolled back if fn returns an error
+	Update(fn func(tx *Tx) error) error
+	// Backup writes a consistent copy of the store to file
+	Backup(file string) error
+	Close() error
+}
+
+// rawtx is what a backend provides inside a transaction
+type rawtx interface {
+	get(bucket, key string) ([]byte, error)
+	put(bucket, key string, value []byte) error
+	del(bucket, key string) error
+	iterate(bucket, prefix string, fn func(key string, value []byte) error) error
+	buckets() ([]string, error)
+	sequence(bucket string) (uint64, error)
+	setsequence(bucket string, seq uint64) error
+}
+
+// Tx reads and writes records of a Store, keeping secondary keys of buckets up to date
+type Tx struct {
+	raw rawtx
+}
+
+// stopiteration stops Iterate without error
+var stopiteration = errors.New("stop iteration")
+
+// Get returns the record of key in bucket, nil if not found.
+// The value is only valid until the transaction ends.
+func (tx *Tx) Get(bucket, key string) ([]byte, error) {
+	return tx.raw.get(bucket, key)
+}
+
+// Put saves value as the record of key in bucket
+func (tx *Tx) Put(bucket, key string, value []byte) error {
+	old, err := tx.raw.get(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := tx.unindex(bucket, key, old); err != nil {
+		return err
+	}
+	if err := tx.raw.put(bucket, key, value); err != nil {
+		return err
+	}
+	return tx.index(bucket, key, value)
+}
+
+// Delete removes the record of key in bucket if any
+func (tx *Tx) Delete(bucket, key string) error {
+	old, err := tx.raw.get(bucket, key)
+	if err != nil || old == nil {
+		return err
+	}
+	if err := tx.unindex(bucket, key, old); err != nil {
+		return err
+	}
+	return tx.raw.del(bucket, key)
+}
+
+// Iterate calls fn with records of bucket whose key starts with prefix in key order,
+// until fn returns stopiteration or an error. fn must not write to bucket.
+func (tx *Tx) Iterate(bucket, prefix string, fn func(key string, value []byte) error) error {
+	err := tx.raw.iterate(bucket, prefix, fn)
+	if err == stopiteration {
+		return nil
+	}
+	return err
+}
+
+// Query lists keys of records in bucket whose secondary key name is value
+func (tx *Tx) Query(bucket, name, value string) ([]string, error) {
+	keys := []string{}
+	prefix := value + "\x00"
+	err := tx.raw.iterate(secondary_bucket(bucket, name), prefix, func(k string, v []byte) error {
+		keys = append(keys, strings.TrimPrefix(k, prefix))
+		return nil
+	})
+	return keys, err
+}
+
+// NextSequence returns the next number of bucket, starting from 1
+func (tx *Tx) NextSequence(bucket string) (uint64, error) {
+	seq, err := tx.raw.sequence(bucket)
+	if err != nil {
+		return 0, err
+	}
+	seq++
+	return seq, tx.raw.setsequence(bucket, seq)
+}
+
+// Buckets lists buckets holding records, buckets of secondary keys are left out
+func (tx *Tx) Buckets() ([]string, error) {
+	all, err := tx.raw.buckets()
+	if err != nil {
+		return nil, err
+	}
+	buckets := []string{}
+	for _, b := range all {
+		if !strings.Contains(b, "/") {
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets, nil
+}
+
+// secondary derives secondary keys of records in bucket, records are queried by them with Tx.Query
+type secondary struct {
+	bucket string
+	name   string
+	keys   func(value []byte) []string
+}
+
+var secondaries = []secondary{
+	{bucket: "readengine", name: "src", keys: doc_src_keys},
+}
+
+func doc_src_keys(value []byte) []string {
+	doc := struct{ Src string }{}
+	if err := json.Unmarshal(value, &doc); err != nil || doc.Src == "" {
+		return nil
+	}
+	return []string{doc.Src}
+}
+
+// secondary_bucket is where keys of bucket are kept by secondary key name
+func secondary_bucket(bucket, name string) string {
+	return bucket + "/" + name
+}
+
+func (tx *Tx) index(bucket, key string, value []byte) error {
+	for _, s := range secondaries {
+		if s.bucket != bucket {
+			continue
+		}
+		for _, k := range s.keys(value) {
+			if err := tx.raw.put(secondary_bucket(bucket, s.name), k+"\x00"+key, []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (tx *Tx) unindex(bucket, key string, value []byte) error {
+	if value == nil {
+		return nil
+	}
+	for _, s := range secondaries {
+		if s.bucket != bucket {
+			continue
+		}
+		for _, k := range s.keys(value) {
+			if err := tx.raw.del(secondary_bucket(bucket, s.name), k+"\x00"+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// store_path is the file of backend in dir
+func store_path(backend, dir string) string {
+	if backend == BackendSqlite {
+		return filepath.Join(dir, "data.sqlite")
+	}
+	return filepath.Join(dir, "data.db")
+}
+
+// open_store opens the store of backend in dir without writing to it,
+// secondary keys of records saved before them are filled by a migration
+func open_store(backend, dir string) (Store, error) {
+	var store Store
+	var err error
+	switch backend {
+	case "", BackendBolt:
+		store, err = open_bolt(store_path(BackendBolt, dir))
+	case BackendSqlite:
+		store, err = open_sqlite(store_path(BackendSqlite, dir))
+	default:
+		return nil, fmt.Errorf("unknown store backend %v", backend)
+	}
+	return store, err
+}
+
+// copy_store copies records and sequences of all buckets from src to dst, returns the number of records
+func copy_store(src, dst Store) (int, error) {
+	count := 0
+	err := src.View(func(stx *Tx) error {
+		buckets, err := stx.Buckets()
+		if err != nil {
+			return err
+		}
+		return dst.Update(func(dtx *Tx) error {
+			for _, bucket := range buckets {
+				err := stx.Iterate(bucket, "", func(k string, v []byte) error {
+					count++
+					return dtx.Put(bucket, k, v)
+				})
+				if err != nil {
+					return err
+				}
+				seq, err := stx.raw.sequence(bucket)
+				if err != nil {
+					return err
+				}
+				if err := dtx.raw.setsequence(bucket, seq); err != nil {
+					return err
+				}
+				logrus.Infof("copied bucket %v", bucket)
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+func migrate_store(c *cli.Context) error {
+	to := c.String("to")
+	if to == "" {
+		return cli.ShowCommandHelp(c, "migrate-store")
+	}
+	load_conf()
+	from := c.String("from")
+	if from == "" {
+		from = conf.Backend
+	}
+	if from == "" {
+		from = BackendBolt
+	}
+	if from == to {
+		err := fmt.Errorf("store is %v already", to)
+		logrus.Error(err)
+		return err
+	}
+
+	src, err := open_store(from, conf.Store)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	defer src.Close()
+	dst, err := open_store(to, conf.Store)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	defer dst.Close()
+	if err := dst.View(func(tx *Tx) error {
+		if buckets, err := tx.Buckets(); err != nil || len(buckets) > 0 {
+			return fmt.Errorf("%v store %v is not empty", to, store_path(to, conf.Store))
+		}
+		return nil
+	}); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	count, err := copy_store(src, dst)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("copied %v records from %v to %v, set backend: %v in config.yaml to use it", count, store_path(from, conf.Store), store_path(to, conf.Store), to)
+	return nil
+}
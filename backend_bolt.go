@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// how long to wait for the lock of a bolt file held by another process such as the daemon
+var boltlock = 5 * time.Second
+
+// boltstore keeps each bucket as a bolt bucket
+type boltstore struct {
+	db *bolt.DB
+}
+
+func open_bolt(file string) (*boltstore, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: boltlock})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("database %v is in use by the daemon or another readengine, stop it or wait for it to finish", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &boltstore{db: db}, nil
+}
+
+// lock_store takes the lock of the store in dir, held by the daemon and other commands until they close the engine.
+// It is taken before opening the index, which waits forever for another process holding it.
+func lock_store(dir string) (*bolt.DB, error) {
+	lock, err := bolt.Open(filepath.Join(dir, "lock"), 0600, &bolt.Options{Timeout: boltlock})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("store %v is in use by the daemon or another readengine, stop it or wait for it to finish", dir)
+	}
+	return lock, err
+}
+
+func (s *boltstore) View(fn func(tx *Tx) error) error {
+	return s.db.View(func(btx *bolt.Tx) error {
+		return fn(&Tx{raw: &bolttx{btx}})
+	})
+}
+
+func (s *boltstore) Update(fn func(tx *Tx) error) error {
+	return s.db.Update(func(btx *bolt.Tx) error {
+		return fn(&Tx{raw: &bolttx{btx}})
+	})
+}
+
+func (s *boltstore) Backup(file string) error {
+	return s.db.View(func(btx *bolt.Tx) error {
+		return btx.CopyFile(file, 0600)
+	})
+}
+
+func (s *boltstore) Close() error {
+	return s.db.Close()
+}
+
+type bolttx struct {
+	tx *bolt.Tx
+}
+
+func (t *bolttx) get(bucket, key string) ([]byte, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, nil
+	}
+	return b.Get([]byte(key)), nil
+}
+
+func (t *bolttx) put(bucket, key string, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value)
+}
+
+func (t *bolttx) del(bucket, key string) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(key))
+}
+
+func (t *bolttx) iterate(bucket, prefix string, fn func(key string, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	p := []byte(prefix)
+	c := b.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(string(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *bolttx) buckets() ([]string, error) {
+	buckets := []string{}
+	err := t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		buckets = append(buckets, string(name))
+		return nil
+	})
+	return buckets, err
+}
+
+func (t *bolttx) sequence(bucket string) (uint64, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return 0, nil
+	}
+	return b.Sequence(), nil
+}
+
+func (t *bolttx) setsequence(bucket string, seq uint64) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.SetSequence(seq)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlitestore keeps all buckets in a table of sqlite with keys as blobs, which sort byte by byte
+// like bolt, writes go through a single connection while reads share a pool
+type sqlitestore struct {
+	reader *sql.DB
+	writer *sql.DB
+}
+
+const sqliteschema = `
+CREATE TABLE IF NOT EXISTS records (
+	bucket TEXT NOT NULL,
+	key BLOB NOT NULL,
+	value BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS sequences (
+	bucket TEXT PRIMARY KEY,
+	seq INTEGER NOT NULL
+);`
+
+func open_sqlite(file string) (*sqlitestore, error) {
+	dsn := "file:" + file + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"
+	//immediate transactions take the write lock up front so that concurrent updates wait for it
+	writer, err := sql.Open("sqlite", dsn+"&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	if _, err := writer.Exec(sqliteschema); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	return &sqlitestore{reader: reader, writer: writer}, nil
+}
+
+func (s *sqlitestore) View(fn func(tx *Tx) error) error {
+	stx, err := s.reader.Begin()
+	if err != nil {
+		return err
+	}
+	defer stx.Rollback()
+	return fn(&Tx{raw: &sqlitetx{stx}})
+}
+
+func (s *sqlitestore) Update(fn func(tx *Tx) error) error {
+	stx, err := s.writer.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&Tx{raw: &sqlitetx{stx}}); err != nil {
+		stx.Rollback()
+		return err
+	}
+	return stx.Commit()
+}
+
+func (s *sqlitestore) Backup(file string) error {
+	_, err := s.writer.Exec("VACUUM INTO ?", file)
+	return err
+}
+
+func (s *sqlitestore) Close() error {
+	s.reader.Close()
+	return s.writer.Close()
+}
+
+type sqlitetx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlitetx) get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := t.tx.QueryRow("SELECT value FROM records WHERE bucket = ? AND key = ?", bucket, []byte(key)).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err == nil && value == nil {
+		value = []byte{}
+	}
+	return value, err
+}
+
+func (t *sqlitetx) put(bucket, key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := t.tx.Exec("INSERT OR REPLACE INTO records (bucket, key, value) VALUES (?, ?, ?)", bucket, []byte(key), value)
+	return err
+}
+
+func (t *sqlitetx) del(bucket, key string) error {
+	_, err := t.tx.Exec("DELETE FROM records WHERE bucket = ? AND key = ?", bucket, []byte(key))
+	return err
+}
+
+// iterate reads the records before calling fn so that fn may query in the same transaction
+func (t *sqlitetx) iterate(bucket, prefix string, fn func(key string, value []byte) error) error {
+	rows, err := t.tx.Query("SELECT key, value FROM records WHERE bucket = ? AND key >= ? ORDER BY key", bucket, []byte(prefix))
+	if err != nil {
+		return err
+	}
+	keys, values := []string{}, [][]byte{}
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		if !strings.HasPrefix(string(key), prefix) {
+			break
+		}
+		keys, values = append(keys, string(key)), append(values, value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if err := fn(key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqlitetx) buckets() ([]string, error) {
+	rows, err := t.tx.Query("SELECT DISTINCT bucket FROM records UNION SELECT bucket FROM sequences ORDER BY bucket")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	buckets := []string{}
+	for rows.Next() {
+		var bucket string
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+func (t *sqlitetx) sequence(bucket string) (uint64, error) {
+	var seq uint64
+	err := t.tx.QueryRow("SELECT seq FROM sequences WHERE bucket = ?", bucket).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func (t *sqlitetx) setsequence(bucket string, seq uint64) error {
+	_, err := t.tx.Exec("INSERT OR REPLACE INTO sequences (bucket, seq) VALUES (?, ?)", bucket, int64(seq))
+	return err
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreBackends(t *testing.T) {
+	for _, backend := range []string{BackendBolt, BackendSqlite} {
+		t.Run(backend, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "readengine")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			store, err := open_store(backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			test_store(t, store)
+		})
+	}
+}
+
+func test_store(t *testing.T, store Store) {
+	err := store.Update(func(tx *Tx) error {
+		for k, v := range map[string]string{
+			"2": `{"Src":"https://b.com"}`,
+			"1": `{"Src":"https://a.com"}`,
+			"3": `{"Src":"https://a.com"}`,
+		} {
+			if err := tx.Put("readengine", k, []byte(v)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Put("feedseen", "https://a.com/feed 1", []byte{}); err != nil {
+			return err
+		}
+		if err := tx.Put("feedseen", "https://a.com/feed.xml 1", []byte("1")); err != nil {
+			return err
+		}
+		for i := 1; i <= 2; i++ {
+			if seq, err := tx.NextSequence("jobs"); err != nil || seq != uint64(i) {
+				t.Errorf("expect sequence %v, got %v %v", i, seq, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a failed update leaves nothing behind
+	failure := errors.New("failure")
+	if err := store.Update(func(tx *Tx) error {
+		tx.Put("readengine", "4", []byte(`{"Src":"https://c.com"}`))
+		return failure
+	}); err != failure {
+		t.Errorf("expect failure returned, got %v", err)
+	}
+
+	err = store.Update(func(tx *Tx) error {
+		//moving doc 3 to another src and deleting doc 2 update their secondary keys
+		if err := tx.Put("readengine", "3", []byte(`{"Src":"https://b.com"}`)); err != nil {
+			return err
+		}
+		return tx.Delete("readengine", "2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.View(func(tx *Tx) error {
+		if v, err := tx.Get("readengine", "1"); err != nil || string(v) != `{"Src":"https://a.com"}` {
+			t.Errorf("unexpected record %s %v", v, err)
+		}
+		for _, k := range []string{"2", "4"} {
+			if v, err := tx.Get("readengine", k); err != nil || v != nil {
+				t.Errorf("expect %v missing, got %s %v", k, v, err)
+			}
+		}
+		if v, err := tx.Get("missing", "1"); err != nil || v != nil {
+			t.Errorf("expect missing bucket empty, got %s %v", v, err)
+		}
+		if v, err := tx.Get("feedseen", "https://a.com/feed 1"); err != nil || v == nil {
+			t.Errorf("expect empty record, got %v %v", v, err)
+		}
+
+		keys := []string{}
+		tx.Iterate("readengine", "", func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if !reflect.DeepEqual(keys, []string{"1", "3"}) {
+			t.Errorf("unexpected keys %v", keys)
+		}
+		keys = []string{}
+		tx.Iterate("feedseen", "https://a.com/feed ", func(k string, v []byte) error {
+			keys = append(keys, k)
+			return stopiteration
+		})
+		if !reflect.DeepEqual(keys, []string{"https://a.com/feed 1"}) {
+			t.Errorf("unexpected prefixed keys %v", keys)
+		}
+
+		for src, expect := range map[string][]string{"https://a.com": {"1"}, "https://b.com": {"3"}, "https://c.com": {}} {
+			if ids, err := tx.Query("readengine", "src", src); err != nil || !reflect.DeepEqual(ids, expect) {
+				t.Errorf("%v: expect %v, got %v %v", src, expect, ids, err)
+			}
+		}
+		if buckets, err := tx.Buckets(); err != nil || !reflect.DeepEqual(buckets, []string{"feedseen", "jobs", "readengine"}) {
+			t.Errorf("unexpected buckets %v %v", buckets, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := open_store(BackendBolt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	//docs written before src was a secondary key
+	err = src.Update(func(tx *Tx) error {
+		if err := tx.raw.put("readengine", "1", []byte(`{"Src":"https://a.com"}`)); err != nil {
+			return err
+		}
+		_, err := tx.NextSequence("jobs")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range [][]string{{"1"}, {}} {
+		err := src.Update(func(tx *Tx) error {
+			keys, err := migrate_secondaries(tx)
+			if err == nil && !reflect.DeepEqual(keys, expect) {
+				t.Errorf("expect secondary keys of %v filled, got %v", expect, keys)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := open_store(BackendSqlite, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if count, err := copy_store(src, dst); err != nil || count != 1 {
+		t.Fatalf("expect 1 record copied, got %v %v", count, err)
+	}
+
+	err = dst.Update(func(tx *Tx) error {
+		if ids, err := tx.Query("readengine", "src", "https://a.com"); err != nil || len(ids) != 1 {
+			t.Errorf("expect src kept, got %v %v", ids, err)
+		}
+		if seq, err := tx.NextSequence("jobs"); err != nil || seq != 2 {
+			t.Errorf("expect sequence continued, got %v %v", seq, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockStore(t *testing.T) {
+	//the other process holding the store, such as the daemon
+	if dir := os.Getenv("READENGINE_LOCK_DIR"); dir != "" {
+		lock, err := lock_store(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Close()
+		os.Stdout.WriteString("locked\n")
+		ioutil.ReadAll(os.Stdin)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockStore$")
+	cmd.Env = append(os.Environ(), "READENGINE_LOCK_DIR="+dir)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		stdin.Close()
+		cmd.Wait()
+		t.Fatalf("expect store locked by other process, got %q %v", line, err)
+	}
+
+	//the store is in use until the other process exits
+	timeout := boltlock
+	boltlock = 100 * time.Millisecond
+	defer func() { boltlock = timeout }()
+	if lock, err := lock_store(dir); err == nil {
+		lock.Close()
+		t.Error("expect store in use")
+	}
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := lock_store(dir)
+	if err != nil {
+		t.Fatalf("expect store unlocked, got %v", err)
+	}
+	lock.Close()
+}
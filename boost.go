@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	bsearch "github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/blevesearch/bleve/search/searcher"
+)
+
+// Boost weights fields and signals when ranking search results
+type Boost struct {
+	Title      float64 `yaml:"title"`
+	Headings   float64 `yaml:"headings"`
+	Tags       float64 `yaml:"tags"`
+	Notes      float64 `yaml:"notes"`
+	Highlights float64 `yaml:"highlights"`
+	Content    float64 `yaml:"content"`
+	//extra boost for docs containing the words of the keyword near each other, 0 to disable
+	Phrase float64 `yaml:"phrase"`
+	//max number of other words between two words of the keyword for the phrase boost, 0 for the exact phrase
+	Slop int `yaml:"slop"`
+	//score of a doc just published, or added when the publish date is unknown, is multiplied by 1+recency,
+	//the bonus halves every halflife days
+	Recency  float64 `yaml:"recency"`
+	HalfLife float64 `yaml:"halflife"`
+}
+
+// number of top hits reranked when recency boost is on
+const rerankwindow = 100
+
+func default_boost() Boost {
+	return Boost{
+		Title:      3,
+		Headings:   2,
+		Tags:       2,
+		Notes:      1.5,
+		Highlights: 1.5,
+		Content:    1,
+		Phrase:     2,
+		Slop:       3,
+		Recency:    0,
+		HalfLife:   90,
+	}
+}
+
+// set_boost overrides one weight of boost given as name=weight
+func set_boost(boost *Boost, s string) error {
+	pos := strings.Index(s, "=")
+	if pos < 0 {
+		return fmt.Errorf("invalid boost %v, expect name=weight", s)
+	}
+	name, value := strings.ToLower(strings.TrimSpace(s[:pos])), strings.TrimSpace(s[pos+1:])
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil || weight < 0 {
+		return fmt.Errorf("invalid boost weight %v", value)
+	}
+	switch name {
+	case "title":
+		boost.Title = weight
+	case "headings":
+		boost.Headings = weight
+	case "tags":
+		boost.Tags = weight
+	case "notes":
+		boost.Notes = weight
+	case "highlights":
+		boost.Highlights = weight
+	case "content":
+		boost.Content = weight
+	case "phrase":
+		boost.Phrase = weight
+	case "slop":
+		boost.Slop = int(weight)
+	case "recency":
+		boost.Recency = weight
+	case "halflife":
+		boost.HalfLife = weight
+	default:
+		return fmt.Errorf("unknown boost %v", name)
+	}
+	return nil
+}
+
+// field_boosts returns the weight of each text field matched by keyword
+func field_boosts(boost Boost) map[string]float64 {
+	fields := map[string]float64{
+		"Note":           boost.Notes,
+		"Highlights":     boost.Highlights,
+		"HighlightNotes": boost.Highlights,
+	}
+	for lang := range langanalyzers {
+		fields[lang+".Title"] = boost.Title
+		fields[lang+".Headings"] = boost.Headings
+		fields[lang+".Content"] = boost.Content
+	}
+	return fields
+}
+
+// fieldquery is a leaf query which can be put on a field with a boost
+type fieldquery interface {
+	query.FieldableQuery
+	SetBoost(b float64)
+}
+
+// fields_query puts a leaf query on each text field with the weight of the field
+func fields_query(boost Boost, leaf func() fieldquery) query.Query {
+	fields := field_boosts(boost)
+	queries := []query.Query{}
+	for _, field := range searchfields {
+		if fields[field] <= 0 {
+			continue
+		}
+		q := leaf()
+		q.SetField(field)
+		q.SetBoost(fields[field])
+		queries = append(queries, q)
+	}
+	if len(queries) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+// keyword_query matches keyword against text fields and tags with their weights,
+// docs containing the words of keyword near each other in title or content score higher
+func keyword_query(keyword string, boost Boost) query.Query {
+	matches := []query.Query{fields_query(boost, func() fieldquery {
+		return bleve.NewMatchQuery(keyword)
+	})}
+	if boost.Tags > 0 {
+		for _, word := range strings.Fields(keyword) {
+			q := bleve.NewTermQuery(normalize_tag(word))
+			q.SetField("Tags")
+			q.SetBoost(boost.Tags)
+			matches = append(matches, q)
+		}
+	}
+	disjunction := bleve.NewDisjunctionQuery(matches...)
+	if boost.Phrase <= 0 || !phrase_keyword(keyword) {
+		return disjunction
+	}
+
+	phrases := []query.Query{}
+	for lang := range langanalyzers {
+		for _, field := range []string{lang + ".Title", lang + ".Content"} {
+			phrases = append(phrases, &proximityquery{phrase: keyword, field: field, slop: boost.Slop, boost: boost.Phrase})
+		}
+	}
+	return query.NewBooleanQuery([]query.Query{disjunction}, phrases, nil)
+}
+
+// proximityquery matches docs containing each two neighbouring words of phrase in field with at most
+// slop other words between them, the score of a pair falls with the square of its gap so that the exact phrase scores highest.
+// bleve phrase queries have no slop, so each gap is a phrase with placeholders in it.
+type proximityquery struct {
+	phrase string
+	field  string
+	slop   int
+	boost  float64
+}
+
+func (q *proximityquery) Searcher(i index.IndexReader, m mapping.IndexMapping, options bsearch.SearcherOptions) (bsearch.Searcher, error) {
+	analyzer := m.AnalyzerNamed(m.AnalyzerNameForPath(q.field))
+	if analyzer == nil {
+		return nil, fmt.Errorf("no analyzer of field %v", q.field)
+	}
+	tokens := analyzer.Analyze([]byte(q.phrase))
+	pairs := []bsearch.Searcher{}
+	for k := 0; k+1 < len(tokens); k++ {
+		//words removed by the analyzer such as stop words still take their places
+		skipped := tokens[k+1].Position - tokens[k].Position - 1
+		if skipped < 0 {
+			continue
+		}
+		for gap := 0; gap <= q.slop; gap++ {
+			terms := [][]string{{string(tokens[k].Term)}}
+			for g := 0; g < skipped+gap; g++ {
+				terms = append(terms, []string{""})
+			}
+			terms = append(terms, []string{string(tokens[k+1].Term)})
+			s, err := query.NewMultiPhraseQuery(terms, q.field).Searcher(i, m, options)
+			if err != nil {
+				closeall(pairs)
+				return nil, err
+			}
+			pairs = append(pairs, &boostedsearcher{Searcher: s, boost: q.boost / float64((gap+1)*(gap+1))})
+		}
+	}
+	if len(pairs) == 0 {
+		return query.NewMatchNoneQuery().Searcher(i, m, options)
+	}
+	return searcher.NewDisjunctionSearcher(i, pairs, 1, options)
+}
+
+func closeall(searchers []bsearch.Searcher) {
+	for _, s := range searchers {
+		s.Close()
+	}
+}
+
+// boostedsearcher multiplies scores of the searcher by boost, bleve phrase searchers ignore the boost of their query
+type boostedsearcher struct {
+	bsearch.Searcher
+	boost float64
+}
+
+func (s *boostedsearcher) Next(ctx *bsearch.SearchContext) (*bsearch.DocumentMatch, error) {
+	return s.scale(s.Searcher.Next(ctx))
+}
+
+func (s *boostedsearcher) Advance(ctx *bsearch.SearchContext, id index.IndexInternalID) (*bsearch.DocumentMatch, error) {
+	return s.scale(s.Searcher.Advance(ctx, id))
+}
+
+func (s *boostedsearcher) scale(match *bsearch.DocumentMatch, err error) (*bsearch.DocumentMatch, error) {
+	if match != nil {
+		match.Score *= s.boost
+	}
+	return match, err
+}
+
+// phrase_keyword reports whether keyword may be split into several terms,
+// cjk text is segmented even without spaces
+func phrase_keyword(keyword string) bool {
+	if len(strings.Fields(keyword)) > 1 {
+		return true
+	}
+	lang := detect_language(keyword)
+	return lang != "" && lang != "en" && len([]rune(keyword)) > 1
+}
+
+// recency_factor is the multiplier of score of a doc published or added at date
+func recency_factor(date time.Time, now time.Time, boost Boost) float64 {
+	if boost.Recency <= 0 || date.IsZero() {
+		return 1
+	}
+	halflife := boost.HalfLife
+	if halflife <= 0 {
+		halflife = default_boost().HalfLife
+	}
+	days := math.Max(0, now.Sub(date).Hours()/24)
+	return 1 + boost.Recency*math.Pow(0.5, days/halflife)
+}
+
+// published_dates returns when docs of hits were published, docs with unknown publish date are left out
+func published_dates(hits bsearch.DocumentMatchCollection) (map[string]time.Time, error) {
+	ids := []string{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	docs, err := get_docs(ids)
+	if err != nil {
+		return nil, err
+	}
+	dates := map[string]time.Time{}
+	for id, doc := range docs {
+		if doc != nil && doc.Published > 0 {
+			dates[id] = time.Unix(doc.Published, 0)
+		}
+	}
+	return dates, nil
+}
+
+// recency_rerank multiplies scores of hits by their recency factor and sorts them again,
+// docs missing from published are dated by when they were added
+func recency_rerank(hits bsearch.DocumentMatchCollection, published map[string]time.Time, now time.Time, boost Boost) {
+	for _, hit := range hits {
+		date, ok := published[hit.ID]
+		if !ok {
+			addtime, err := strconv.ParseInt(hit.ID, 10, 64)
+			if err != nil {
+				continue
+			}
+			date = time.Unix(addtime, 0)
+		}
+		hit.Score *= recency_factor(date, now, boost)
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	bsearch "github.com/blevesearch/bleve/search"
+)
+
+func TestSetBoost(t *testing.T) {
+	boost := default_boost()
+	if err := set_boost(&boost, "Title=5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set_boost(&boost, "recency = 0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if boost.Title != 5 || boost.Recency != 0.5 {
+		t.Errorf("unexpected boost %+v", boost)
+	}
+	for _, s := range []string{"title", "title=x", "title=-1", "author=2"} {
+		if err := set_boost(&boost, s); err == nil {
+			t.Errorf("expect error for %v", s)
+		}
+	}
+}
+
+func TestRecencyRerank(t *testing.T) {
+	now := time.Unix(1538352000, 0)
+	boost := default_boost()
+	boost.Recency = 1
+	boost.HalfLife = 30
+
+	if f := recency_factor(now, now, boost); f != 2 {
+		t.Errorf("expect factor 2 for a doc added now, got %v", f)
+	}
+	if f := recency_factor(now.AddDate(0, 0, -30), now, boost); f != 1.5 {
+		t.Errorf("expect factor 1.5 after one halflife, got %v", f)
+	}
+
+	//an old doc with a slightly higher score falls behind a new one
+	hits := bsearch.DocumentMatchCollection{
+		{ID: "1514764800", Score: 1.2},
+		{ID: "1538352000", Score: 1},
+	}
+	recency_rerank(hits, nil, now, boost)
+	if hits[0].ID != "1538352000" {
+		t.Errorf("expect recent doc first, got %v", hits[0].ID)
+	}
+
+	//a doc added lately but published long ago falls behind an older one
+	hits = bsearch.DocumentMatchCollection{
+		{ID: "1538352000", Score: 1},
+		{ID: "1530403200", Score: 1},
+	}
+	recency_rerank(hits, map[string]time.Time{"1538352000": time.Unix(1420070400, 0)}, now, boost)
+	if hits[0].ID != "1530403200" {
+		t.Errorf("expect recently published doc first, got %v", hits[0].ID)
+	}
+}
+
+func TestPhraseProximity(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Src: "https://a.com", Title: "Notes", Content: "Each pool of goroutines has a worker for every job, channels hand jobs over."},
+		{Id: "1517443200", Src: "https://b.com", Title: "Notes", Content: "Each goroutine is a worker in the pool, channels hand jobs over to it."},
+		{Id: "1519862400", Src: "https://c.com", Title: "Notes", Content: "Each goroutine is a worker pool member, channels hand jobs over to it."},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//words next to each other rank above words a few apart, which rank above words far apart
+	res, err := run_search(&searchoptions{Keyword: "worker pool", Limit: 10, Boost: default_boost()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, hit := range res.Hits {
+		ids = append(ids, hit.ID)
+	}
+	if len(ids) != 3 || ids[0] != "1519862400" || ids[1] != "1517443200" {
+		t.Errorf("expect exact phrase then near words first, got %v", ids)
+	}
+}
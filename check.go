@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+//link status of indexed docs
+const (
+	StatusAlive      = "alive"
+	StatusRedirected = "redirected"
+	StatusNotFound   = "notfound"
+	StatusGone       = "gone"
+	StatusChanged    = "changed"
+	StatusError      = "error"
+)
+
+func check(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	interval := c.Duration("interval")
+	for {
+		ids := []string(c.Args())
+		if len(ids) == 0 {
+			var err error
+			ids, err = doc_ids()
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+		}
+
+		check_ids(ids, nil)
+
+		if interval <= 0 {
+			break
+		}
+		logrus.Infof("next check at %v", time.Now().Add(interval).Format(time.RFC3339))
+		time.Sleep(interval)
+	}
+
+	return nil
+}
+
+//check_ids checks docs of ids until stop is closed
+func check_ids(ids []string, stop <-chan struct{}) {
+	counts := map[string]int{}
+	checked := 0
+	for _, id := range ids {
+		select {
+		case <-stop:
+			logrus.Info("check stopped")
+			return
+		default:
+		}
+		checked++
+		doc, err := get_doc(id)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if doc == nil {
+			logrus.Errorf("doc %v not found", id)
+			continue
+		}
+
+		check_doc(doc)
+		counts[doc.Status]++
+		logrus.Infof("[%v]%v %v", doc.Status, doc.Title, doc.Src)
+
+		if err := save_doc(doc); err != nil {
+			logrus.Error(err)
+		}
+	}
+	logrus.Infof("checked %v docs: %v", checked, counts)
+}
+
+//check_doc revisits doc.Src and updates link status of doc
+func check_doc(doc *Doc) {
+	doc.CheckedAt = time.Now().Unix()
+
+	res, err := extractor.Check(doc.Src, doc.ETag, doc.LastModified)
+	if err != nil {
+		logrus.Warnf("check %v: %v", doc.Src, err)
+		doc.Status = StatusError
+		doc.StatusCode = 0
+		return
+	}
+
+	doc.StatusCode = res.StatusCode
+	doc.Location = res.Location
+	doc.ETag = res.ETag
+	doc.LastModified = res.LastModified
+
+	switch {
+	case res.NotModified:
+		//unchanged since last check, keep a detected content change
+		if doc.Status != StatusChanged {
+			doc.Status = StatusAlive
+		}
+	case res.StatusCode == http.StatusOK:
+		if res.Content != doc.Content {
+			doc.Status = StatusChanged
+		} else {
+			doc.Status = StatusAlive
+		}
+	case res.StatusCode >= 300 && res.StatusCode < 400:
+		doc.Status = StatusRedirected
+	case res.StatusCode == http.StatusNotFound:
+		doc.Status = StatusNotFound
+	case res.StatusCode == http.StatusGone:
+		doc.Status = StatusGone
+	default:
+		doc.Status = StatusError
+	}
+}
+
+//status_label formats link status for output, empty for docs never checked
+func status_label(status interface{}) string {
+	if s, ok := status.(string); ok && s != "" {
+		return "[" + s + "]"
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckDoc(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/cached":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("<html><head><title>cached</title></head><body><p>hello</p></body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		path   string
+		etag   string
+		status string
+	}{
+		{"/moved", "", StatusRedirected},
+		{"/gone", "", StatusGone},
+		{"/missing", "", StatusNotFound},
+		{"/cached", `"v1"`, StatusAlive},
+	}
+	for _, cs := range cases {
+		doc := &Doc{Src: ts.URL + cs.path, ETag: cs.etag}
+		check_doc(doc)
+		if doc.Status != cs.status {
+			t.Errorf("%v: expect status %v, got %v", cs.path, cs.status, doc.Status)
+		}
+		if doc.CheckedAt == 0 {
+			t.Errorf("%v: CheckedAt not set", cs.path)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// states of crawled pages
+const (
+	PagePending = "pending"
+	PageDone    = "done"
+	PageFailed  = "failed"
+	//disallowed by robots.txt
+	PageSkipped = "skipped"
+)
+
+// Crawl is the scope of crawling a site from Seed, kept to resume the crawl
+type Crawl struct {
+	Seed string
+	Host string
+	//only paths under Prefix are crawled
+	Prefix string
+	//links are followed this many hops from the seed
+	MaxDepth int
+	//regexps urls must match one of, and must not match any of
+	Include   []string
+	Exclude   []string
+	StartedAt int64
+	UpdatedAt int64
+}
+
+// CrawlPage is a url found while crawling
+type CrawlPage struct {
+	Url    string
+	Depth  int
+	Seq    uint64
+	Status string
+	Error  string `json:",omitempty"`
+	DocId  string `json:",omitempty"`
+}
+
+// files that are not pages are not fetched
+var crawlskip = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true, ".ico": true,
+	".css": true, ".js": true, ".json": true, ".xml": true, ".rss": true, ".atom": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tgz": true, ".tar": true, ".rar": true, ".7z": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+}
+
+// crawl_key is the key of a page of crawl seed in bucket crawlpages
+func crawl_key(seed, u string) string {
+	return seed + " " + u
+}
+
+func get_crawl(seed string) (*Crawl, error) {
+	var crawl *Crawl
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("crawls", seed)
+		if err != nil || v == nil {
+			return err
+		}
+		crawl = &Crawl{}
+		return json.Unmarshal(v, crawl)
+	})
+	return crawl, err
+}
+
+func put_crawl(crawl *Crawl) error {
+	return db.Update(func(tx *Tx) error {
+		data, err := json.Marshal(crawl)
+		if err != nil {
+			return err
+		}
+		return tx.Put("crawls", crawl.Seed, data)
+	})
+}
+
+func list_crawls() ([]*Crawl, error) {
+	crawls := []*Crawl{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("crawls", "", func(k string, v []byte) error {
+			crawl := &Crawl{}
+			if err := json.Unmarshal(v, crawl); err != nil {
+				return err
+			}
+			crawls = append(crawls, crawl)
+			return nil
+		})
+	})
+	return crawls, err
+}
+
+// del_crawl removes crawl seed and its pages, indexed docs are kept
+func del_crawl(seed string) error {
+	return db.Update(func(tx *Tx) error {
+		if err := tx.Delete("crawls", seed); err != nil {
+			return err
+		}
+		keys := []string{}
+		err := tx.Iterate("crawlpages", crawl_key(seed, ""), func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete("crawlpages", k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// crawl_pages lists pages of crawl seed with status, or all pages when status is empty,
+// ordered by depth then by the order they were found
+func crawl_pages(seed, status string) ([]*CrawlPage, error) {
+	pages := []*CrawlPage{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("crawlpages", crawl_key(seed, ""), func(k string, v []byte) error {
+			page := &CrawlPage{}
+			if err := json.Unmarshal(v, page); err != nil {
+				return err
+			}
+			if status == "" || page.Status == status {
+				pages = append(pages, page)
+			}
+			return nil
+		})
+	})
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Depth != pages[j].Depth {
+			return pages[i].Depth < pages[j].Depth
+		}
+		return pages[i].Seq < pages[j].Seq
+	})
+	return pages, err
+}
+
+// add_pages adds pages to crawl seed as pending, urls already found are left as they are
+func add_pages(seed string, pages []*CrawlPage) (int, error) {
+	added := 0
+	err := db.Update(func(tx *Tx) error {
+		for _, page := range pages {
+			key := crawl_key(seed, page.Url)
+			if v, err := tx.Get("crawlpages", key); err != nil {
+				return err
+			} else if v != nil {
+				continue
+			}
+			seq, err := tx.NextSequence("crawlpages")
+			if err != nil {
+				return err
+			}
+			page.Seq = seq
+			page.Status = PagePending
+			data, err := json.Marshal(page)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put("crawlpages", key, data); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+func put_page(seed string, page *CrawlPage) error {
+	return db.Update(func(tx *Tx) error {
+		data, err := json.Marshal(page)
+		if err != nil {
+			return err
+		}
+		return tx.Put("crawlpages", crawl_key(seed, page.Url), data)
+	})
+}
+
+// crawlscope decides which urls belong to a crawl
+type crawlscope struct {
+	crawl   *Crawl
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func new_scope(crawl *Crawl) (*crawlscope, error) {
+	include, err := compile_regexps(crawl.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compile_regexps(crawl.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &crawlscope{crawl: crawl, include: include, exclude: exclude}, nil
+}
+
+func compile_regexps(exprs []string) ([]*regexp.Regexp, error) {
+	rs := []*regexp.Regexp{}
+	for _, expr := range exprs {
+		r, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// match_urls reports whether u matches one of include, or include is empty, and none of exclude
+func match_urls(u string, include, exclude []*regexp.Regexp) bool {
+	matched := len(include) == 0
+	for _, r := range include {
+		if r.MatchString(u) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, r := range exclude {
+		if r.MatchString(u) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether u is on the host and under the prefix of the crawl and passes its regexps
+func (s *crawlscope) allows(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	if !strings.EqualFold(parsed.Host, s.crawl.Host) {
+		return false
+	}
+	p := parsed.Path
+	if p == "" {
+		p = "/"
+	}
+	if !strings.HasPrefix(p, s.crawl.Prefix) || crawlskip[strings.ToLower(path.Ext(p))] {
+		return false
+	}
+	return match_urls(u, s.include, s.exclude)
+}
+
+// crawl_url drops the fragment of u, which points into the same page
+func crawl_url(u string) string {
+	if pos := strings.Index(u, "#"); pos >= 0 {
+		return u[:pos]
+	}
+	return u
+}
+
+// crawler fetches pages of a crawl, indexing those not in the store yet
+type crawler struct {
+	crawl *Crawl
+	scope *crawlscope
+	//src of docs in the store to their ids, guarded by lock together with saving docs
+	srcs map[string]string
+	lock sync.Mutex
+}
+
+// run_crawl crawls pending pages until none is left, limit pages are fetched or stop is closed,
+// each round fetches the pages pending at its start with concurrency workers
+func run_crawl(crawl *Crawl, concurrency, limit int, stop <-chan struct{}) (int, error) {
+	scope, err := new_scope(crawl)
+	if err != nil {
+		return 0, err
+	}
+	srcs, err := stored_srcs()
+	if err != nil {
+		return 0, err
+	}
+	cr := &crawler{crawl: crawl, scope: scope, srcs: srcs}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	fetched := 0
+	for {
+		pages, err := crawl_pages(crawl.Seed, PagePending)
+		if err != nil {
+			return fetched, err
+		}
+		if len(pages) == 0 {
+			return fetched, nil
+		}
+		if limit > 0 && fetched+len(pages) > limit {
+			pages = pages[:limit-fetched]
+		}
+
+		queue := make(chan *CrawlPage)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for page := range queue {
+					cr.fetch(page)
+				}
+			}()
+		}
+		stopped := false
+	dispatch:
+		for _, page := range pages {
+			select {
+			case <-stop:
+				stopped = true
+				break dispatch
+			case queue <- page:
+				fetched++
+			}
+		}
+		close(queue)
+		wg.Wait()
+
+		crawl.UpdatedAt = time.Now().Unix()
+		if err := put_crawl(crawl); err != nil {
+			return fetched, err
+		}
+		if stopped || (limit > 0 && fetched >= limit) {
+			return fetched, nil
+		}
+	}
+}
+
+// fetch indexes page unless it is in the store and adds links in scope to the crawl
+func (cr *crawler) fetch(page *CrawlPage) {
+	content, err := extractor.ParseContent(page.Url)
+	switch {
+	case err == extractor.ErrDisallowed:
+		page.Status, page.Error = PageSkipped, err.Error()
+	case err != nil:
+		page.Status, page.Error = PageFailed, err.Error()
+	default:
+		page.Status, page.Error = PageDone, ""
+		page.DocId, err = cr.index(page.Url, content)
+		if err != nil {
+			page.Status, page.Error = PageFailed, err.Error()
+		}
+	}
+	if page.Status == PageDone {
+		logrus.Infof("crawled %v (depth %v)", page.Url, page.Depth)
+	} else {
+		logrus.Warnf("crawl %v: %v", page.Url, page.Error)
+	}
+	if err := put_page(cr.crawl.Seed, page); err != nil {
+		logrus.Error(err)
+		return
+	}
+	if page.Status != PageDone || page.Depth >= cr.crawl.MaxDepth {
+		return
+	}
+
+	links := []*CrawlPage{}
+	for _, link := range content.Links {
+		link = crawl_url(link)
+		if cr.scope.allows(link) {
+			links = append(links, &CrawlPage{Url: link, Depth: page.Depth + 1})
+		}
+	}
+	if _, err := add_pages(cr.crawl.Seed, links); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// index saves content of u as a new doc and returns its id, or the id of the doc already stored for u
+func (cr *crawler) index(u string, content *extractor.Content) (string, error) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	if id, ok := cr.srcs[u]; ok {
+		return id, nil
+	}
+	doc, err := page_doc(u, content)
+	if err != nil {
+		return "", err
+	}
+	if err := save_doc(doc); err != nil {
+		return "", err
+	}
+	cr.srcs[u] = doc.Id
+	alert_saved(doc)
+	return doc.Id, nil
+}
+
+// new_crawl makes a crawl of seed from flags, the prefix defaults to the directory of the seed
+func new_crawl(c *cli.Context, seed string) (*Crawl, error) {
+	u, err := url.Parse(seed)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%v is not a http url", seed)
+	}
+	prefix := c.String("prefix")
+	if prefix == "" {
+		prefix = u.Path[:strings.LastIndex(u.Path, "/")+1]
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	crawl := &Crawl{
+		Seed:      seed,
+		Host:      u.Host,
+		Prefix:    prefix,
+		MaxDepth:  c.Int("depth"),
+		Include:   c.StringSlice("include"),
+		Exclude:   c.StringSlice("exclude"),
+		StartedAt: time.Now().Unix(),
+	}
+	crawl.UpdatedAt = crawl.StartedAt
+	_, err = new_scope(crawl)
+	return crawl, err
+}
+
+func crawl_site(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+	if c.NArg() == 0 {
+		return crawl_list()
+	}
+
+	//crawls honor robots.txt and space requests even if fetching in general does not
+	fetch := conf.Fetch
+	fetch.Robots = !c.Bool("ignore-robots")
+	if c.IsSet("rps") || fetch.HostRPS <= 0 {
+		fetch.HostRPS = c.Float64("rps")
+	}
+	set_politeness(fetch)
+
+	seed := crawl_url(c.Args().First())
+	if c.Bool("restart") {
+		if err := del_crawl(seed); err != nil {
+			logrus.Error(err)
+			return err
+		}
+	}
+	crawl, err := get_crawl(seed)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if crawl == nil {
+		if crawl, err = new_crawl(c, seed); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if err := put_crawl(crawl); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		seeds := []*CrawlPage{{Url: seed}}
+		if c.Bool("sitemap") {
+			u, _ := url.Parse(seed)
+			entries, err := sitemap_urls(u.Scheme + "://" + u.Host + "/sitemap.xml")
+			if err != nil {
+				logrus.Errorf("sitemap: %v", err)
+			}
+			scope, _ := new_scope(crawl)
+			for _, entry := range entries {
+				if u := crawl_url(entry.Loc); scope.allows(u) {
+					seeds = append(seeds, &CrawlPage{Url: u})
+				}
+			}
+			logrus.Infof("seeding %v pages from sitemap", len(seeds)-1)
+		}
+		if _, err := add_pages(seed, seeds); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("crawling %v%v up to depth %v", crawl.Host, crawl.Prefix, crawl.MaxDepth)
+	} else {
+		logrus.Infof("resuming crawl of %v%v up to depth %v", crawl.Host, crawl.Prefix, crawl.MaxDepth)
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		logrus.Info("stopping, run again to resume")
+		close(stop)
+	}()
+
+	concurrency := conf.Daemon.Concurrency
+	if c.IsSet("concurrency") {
+		concurrency = c.Int("concurrency")
+	}
+	fetched, err := run_crawl(crawl, concurrency, c.Int("limit"), stop)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	counts, err := crawl_counts(seed)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("fetched %v pages, %v", fetched, counts)
+	return nil
+}
+
+// crawl_counts counts pages of crawl seed by status
+func crawl_counts(seed string) (map[string]int, error) {
+	pages, err := crawl_pages(seed, "")
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, page := range pages {
+		counts[page.Status]++
+	}
+	return counts, nil
+}
+
+// crawl_list shows crawls with the count of pages by status
+func crawl_list() error {
+	crawls, err := list_crawls()
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(crawls) == 0 {
+		logrus.Info("未找到数据")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, crawl := range crawls {
+		counts, err := crawl_counts(crawl.Seed)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		fmt.Fprintf(w, "%v\t%v\tdepth %v\t%v done\t%v pending\t%v failed\t%v skipped\n", crawl.Seed,
+			time.Unix(crawl.UpdatedAt, 0).Format("2006-01-02 15:04:05"), crawl.MaxDepth,
+			counts[PageDone], counts[PagePending], counts[PageFailed], counts[PageSkipped])
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawl(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := func(title string, links ...string) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			body := ""
+			for _, link := range links {
+				body += fmt.Sprintf(`<a href="%v">%v</a> `, link, link)
+			}
+			fmt.Fprintf(w, `<html><head><title>%v</title></head><body><article><h1>%v</h1><p>%v is a page of the docs site, it explains one part of the tool in a few sentences.</p>%v</article></body></html>`, title, title, title, body)
+		}
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /docs/private\n"))
+		case "/docs/":
+			page("Index", "a", "/docs/b#install", "/blog/x", "img.png", "https://example.com/docs/", "private", "skip-me", server.URL+"/docs/a")
+		case "/docs/a":
+			page("A", "c", "../docs/")
+		case "/docs/b":
+			page("B")
+		case "/docs/c":
+			page("C", "d")
+		case "/docs/d", "/docs/skip-me", "/blog/x", "/docs/private":
+			page("Out of scope")
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><sitemap><loc>%v/sitemap-docs.xml.gz</loc></sitemap><sitemap><loc>%v/missing.xml</loc></sitemap></sitemapindex>`, server.URL, server.URL)
+		case "/sitemap-docs.xml.gz":
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>%v/docs/e</loc><lastmod>2018-03-01</lastmod></url><url><loc>%v/blog/y</loc></url></urlset>`, server.URL, server.URL)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer set_politeness(Fetch{})
+	set_politeness(Fetch{Robots: true})
+
+	entries, err := sitemap_urls(server.URL + "/sitemap.xml")
+	if err != nil || len(entries) != 2 || entries[0].Loc != server.URL+"/docs/e" || entries[0].LastMod.Year() != 2018 {
+		t.Errorf("unexpected sitemap entries %+v %v", entries, err)
+	}
+
+	//b is in the store already
+	if err := put_doc(&Doc{Id: "1", Src: server.URL + "/docs/b", Title: "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := server.URL + "/docs/"
+	crawl := &Crawl{Seed: seed, Host: server.Listener.Addr().String(), Prefix: "/docs/", MaxDepth: 2, Exclude: []string{"skip"}}
+	if err := put_crawl(crawl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add_pages(seed, []*CrawlPage{{Url: seed}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//stopped after the seed, resumed with the links found on it
+	if fetched, err := run_crawl(crawl, 2, 1, nil); err != nil || fetched != 1 {
+		t.Fatalf("expect 1 page fetched, got %v %v", fetched, err)
+	}
+	if pending, _ := crawl_pages(seed, PagePending); len(pending) != 3 {
+		t.Errorf("expect 3 pending pages, got %+v", pending)
+	}
+	if fetched, err := run_crawl(crawl, 2, 0, nil); err != nil || fetched != 4 {
+		t.Fatalf("expect 4 pages fetched, got %v %v", fetched, err)
+	}
+
+	pages, err := crawl_pages(seed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]string{}
+	for _, page := range pages {
+		status[page.Url[len(server.URL):]] = page.Status
+	}
+	expect := map[string]string{"/docs/": PageDone, "/docs/a": PageDone, "/docs/b": PageDone, "/docs/private": PageSkipped, "/docs/c": PageDone}
+	if len(status) != len(expect) {
+		t.Errorf("expect pages %v, got %v", expect, status)
+	}
+	for u, s := range expect {
+		if status[u] != s {
+			t.Errorf("%v: expect %v, got %v", u, s, status[u])
+		}
+	}
+
+	srcs, err := stored_srcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcs) != 4 || srcs[server.URL+"/docs/b"] != "1" || srcs[server.URL+"/docs/c"] == "" {
+		t.Errorf("unexpected docs %v", srcs)
+	}
+	if counts, _ := crawl_counts(seed); counts[PageDone] != 4 || counts[PagePending] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+
+	if err := del_crawl(seed); err != nil {
+		t.Fatal(err)
+	}
+	if pages, _ := crawl_pages(seed, ""); len(pages) != 0 {
+		t.Errorf("expect pages removed, got %+v", pages)
+	}
+}
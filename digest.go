@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// SMTP is the server digests are sent through, Addr is host:port, Username may be empty
+// for servers without authentication
+type SMTP struct {
+	Addr     string   `yaml:"addr"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// max runes of content in the excerpt of a digest item
+const excerptlength = 300
+
+// digestitem is a doc as listed in a digest
+type digestitem struct {
+	Title       string
+	Src         string
+	Domain      string
+	Excerpt     string
+	ReadingTime int
+	Tags        []string
+}
+
+// digest is what gets rendered as the email
+type digest struct {
+	Subject string
+	Since   string
+	Until   string
+	Items   []digestitem
+}
+
+// excerpt is the beginning of text with whitespace collapsed, at most n runes
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > n {
+		text = string([]rune(text)[:n]) + "…"
+	}
+	return text
+}
+
+// new_digest lists docs added between since and until
+func new_digest(docs []*Doc, since, until time.Time) *digest {
+	d := &digest{Since: since.Format("2006-01-02"), Until: until.Format("2006-01-02")}
+	for _, doc := range docs {
+		d.Items = append(d.Items, digestitem{
+			Title:       doc.Title,
+			Src:         doc.Src,
+			Domain:      doc_domain(doc),
+			Excerpt:     excerpt(doc.Content, excerptlength),
+			ReadingTime: doc_reading_time(doc),
+			Tags:        doc.Tags,
+		})
+	}
+	period := d.Since
+	if d.Until != d.Since {
+		period += " ~ " + d.Until
+	}
+	d.Subject = fmt.Sprintf("ReadEngine digest %v: %v docs", period, len(d.Items))
+	return d
+}
+
+var digesttext = texttemplate.Must(texttemplate.New("text").Parse(`{{.Subject}}
+{{range .Items}}
+{{.Title}}
+{{.Src}}
+{{.Domain}} · {{.ReadingTime}} min{{with .Tags}} · {{range $i, $t := .}}{{if $i}}, {{end}}{{$t}}{{end}}{{end}}
+{{.Excerpt}}
+{{end}}`))
+
+var digesthtml = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; max-width: 640px; margin: 0 auto;">
+<h1 style="font-size: 20px;">{{.Subject}}</h1>
+{{- range .Items}}
+<div style="margin: 24px 0;">
+  <h2 style="font-size: 16px; margin: 0;"><a href="{{.Src}}">{{.Title}}</a></h2>
+  <p style="color: #666; font-size: 13px; margin: 4px 0;">{{.Domain}} · {{.ReadingTime}} min{{with .Tags}} · {{range $i, $t := .}}{{if $i}}, {{end}}{{$t}}{{end}}{{end}}</p>
+  <p style="margin: 4px 0;">{{.Excerpt}}</p>
+</div>
+{{- end}}
+</body>
+</html>
+`))
+
+// digest_message renders d as a multipart email with text and html alternatives
+func digest_message(d *digest, from string, to []string, now time.Time) ([]byte, error) {
+	text, html := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := digesttext.Execute(text, d); err != nil {
+		return nil, err
+	}
+	if err := digesthtml.Execute(html, d); err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for _, part := range []struct {
+		contenttype string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contenttype)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %v\r\n", from)
+	fmt.Fprintf(msg, "To: %v\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", d.Subject))
+	fmt.Fprintf(msg, "Date: %v\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%v\r\n\r\n", w.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// send_mail sends msg through server, authenticating when a username is configured
+func send_mail(server SMTP, to []string, msg []byte) error {
+	if server.Addr == "" {
+		return errors.New("missing smtp addr in config")
+	}
+	var auth smtp.Auth
+	if server.Username != "" {
+		host, _, err := net.SplitHostPort(server.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", server.Username, server.Password, host)
+	}
+	return smtp.SendMail(server.Addr, auth, server.From, to, msg)
+}
+
+func send_digest(c *cli.Context) error {
+	since, err := parse_date(c.String("since"), false)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	until, err := parse_date(c.String("until"), true)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	init_engine(c)
+	defer close_engine()
+
+	to := conf.Smtp.To
+	if len(c.StringSlice("to")) > 0 {
+		to = c.StringSlice("to")
+	}
+	output := c.String("output")
+	if output == "" && len(to) == 0 {
+		logrus.Error("missing recipients, set smtp.to in config or --to")
+		return cli.ShowCommandHelp(c, "digest")
+	}
+
+	docs, err := published_docs(&publishoptions{Since: since, Until: until, Limit: c.Int("limit")})
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(docs) == 0 {
+		logrus.Info("未找到数据")
+		return nil
+	}
+	if since.IsZero() {
+		since = doc_added(docs[len(docs)-1])
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	d := new_digest(docs, since, until)
+	msg, err := digest_message(d, conf.Smtp.From, to, time.Now())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if output != "" {
+		if err := ioutil.WriteFile(output, msg, 0644); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("wrote digest of %v docs to %v", len(docs), output)
+		return nil
+	}
+	if err := send_mail(conf.Smtp, to, msg); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("sent digest of %v docs to %v", len(docs), strings.Join(to, ", "))
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestMessage(t *testing.T) {
+	docs := []*Doc{
+		{Id: "1514851200", Src: "https://blog.golang.org/pipelines", Title: "Go pipelines <&>", Content: strings.Repeat("goroutine ", 400), Tags: []string{"go", "concurrency"}},
+		{Id: "1514764800", Src: "https://www.example.com/zh", Title: "中文标题", Content: "第一段"},
+	}
+	since := time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local)
+	d := new_digest(docs, since, since.AddDate(0, 0, 1))
+	if d.Subject != "ReadEngine digest 2018-01-01 ~ 2018-01-02: 2 docs" {
+		t.Errorf("unexpected subject %v", d.Subject)
+	}
+	if d.Items[0].ReadingTime != 2 || d.Items[1].Domain != "example.com" || !strings.HasSuffix(d.Items[0].Excerpt, "…") {
+		t.Errorf("unexpected items %+v", d.Items)
+	}
+
+	msg, err := digest_message(d, "readengine@example.com", []string{"a@example.com", "b@example.com"}, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != d.Subject {
+		t.Errorf("unexpected subject %v %v", subject, err)
+	}
+	if to, err := m.Header.AddressList("To"); err != nil || len(to) != 2 {
+		t.Errorf("unexpected recipients %v %v", to, err)
+	}
+	mediatype, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediatype != "multipart/alternative" {
+		t.Fatalf("unexpected content type %v %v", mediatype, err)
+	}
+
+	parts := map[string]string{}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(quotedprintable.NewReader(p))
+		parts[strings.Split(p.Header.Get("Content-Type"), ";")[0]] = string(content)
+	}
+	if !strings.Contains(parts["text/plain"], "blog.golang.org · 2 min · go, concurrency") ||
+		!strings.Contains(parts["text/plain"], "中文标题") {
+		t.Errorf("unexpected text part\n%v", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], `<a href="https://blog.golang.org/pipelines">Go pipelines &lt;&amp;&gt;</a>`) {
+		t.Errorf("unexpected html part\n%v", parts["text/html"])
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	//a minimal smtp server standing in for the real one
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost\r\n"))
+		data, rcpt := &bytes.Buffer{}, 0
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+			case "EHLO", "HELO", "MAIL":
+				conn.Write([]byte("250 ok\r\n"))
+			case "RCPT":
+				rcpt++
+				conn.Write([]byte("250 ok\r\n"))
+			case "DATA":
+				conn.Write([]byte("354 go ahead\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				conn.Write([]byte("250 ok\r\n"))
+			case "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				if rcpt == 2 {
+					received <- data.String()
+				}
+				close(received)
+				return
+			default:
+				conn.Write([]byte("502 unknown\r\n"))
+			}
+		}
+	}()
+
+	server := SMTP{Addr: l.Addr().String(), From: "readengine@example.com"}
+	if err := send_mail(server, []string{"a@example.com", "b@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; !strings.Contains(data, "Subject: hi") {
+		t.Errorf("unexpected data %q", data)
+	}
+	if err := send_mail(SMTP{}, []string{"a@example.com"}, nil); err == nil {
+		t.Error("expect error without smtp addr")
+	}
+}
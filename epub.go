@@ -0,0 +1,393 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// chapter is a doc rendered as a chapter of an epub, Toc lists indexes of sections with heading
+type chapter struct {
+	File     string
+	Doc      *Doc
+	Domain   string
+	Added    string
+	Sections []section
+	Toc      []int
+	Images   []epubimage
+}
+
+// epubimage is an image of a doc embedded in the epub at File, relative to the package
+type epubimage struct {
+	Id        string
+	File      string
+	MediaType string
+	data      []byte
+}
+
+// extensions of image types epub readers support
+var epubimagetypes = map[string]string{
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+// fetch_image returns data and media type of an image url, replaced in tests
+var fetch_image = extractor.FetchImage
+
+// chapter_images fetches images of doc for the chapter file, images failing to fetch
+// or of types epub readers do not support are logged and left out
+func chapter_images(file string, doc *Doc) []epubimage {
+	images := []epubimage{}
+	seen := map[string]bool{}
+	for _, url := range doc.Images {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		data, mediatype, err := fetch_image(url)
+		if err != nil {
+			logrus.Warnf("image %v of doc %v: %v", url, doc.Id, err)
+			continue
+		}
+		ext, ok := epubimagetypes[mediatype]
+		if !ok {
+			logrus.Warnf("image %v of doc %v: unsupported type %v", url, doc.Id, mediatype)
+			continue
+		}
+		name := fmt.Sprintf("%v-img-%02d", file, len(images)+1)
+		images = append(images, epubimage{Id: name, File: "images/" + name + ext, MediaType: mediatype, data: data})
+	}
+	return images
+}
+
+// epubfile is a file in the epub, rendered by tmpl from data or given as text, which holds the data of images
+type epubfile struct {
+	name string
+	tmpl *template.Template
+	data interface{}
+	text string
+}
+
+// section is a part of the content under a heading, the first one may have no heading
+type section struct {
+	Heading    string
+	Paragraphs []string
+}
+
+// doc_sections splits content into paragraphs by line and into sections by the headings of doc,
+// headings are looked up in order so that content extracted as one line is structured too
+func doc_sections(doc *Doc) []section {
+	sections := []section{}
+	current := section{}
+	addtext := func(text string) {
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				current.Paragraphs = append(current.Paragraphs, line)
+			}
+		}
+	}
+
+	content := doc.Content
+	for _, heading := range doc.Headings {
+		heading = strings.TrimSpace(heading)
+		if heading == "" || heading == doc.Title {
+			continue
+		}
+		pos := strings.Index(content, heading)
+		if pos < 0 {
+			continue
+		}
+		addtext(content[:pos])
+		if current.Heading != "" || len(current.Paragraphs) > 0 {
+			sections = append(sections, current)
+		}
+		current = section{Heading: heading}
+		content = content[pos+len(heading):]
+	}
+	addtext(content)
+	if current.Heading != "" || len(current.Paragraphs) > 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// epub_language is the most common language of docs, zh if unknown
+func epub_language(docs []*Doc) string {
+	counts := map[string]int{}
+	lang := "zh"
+	for _, doc := range docs {
+		if l := doc_language(doc); l != "" {
+			counts[l]++
+			if counts[l] > counts[lang] {
+				lang = l
+			}
+		}
+	}
+	return lang
+}
+
+var epubcontainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var epubstyle = `body { font-family: serif; line-height: 1.5; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.15em; }
+.meta { color: #555; font-size: 0.85em; }
+.note { border-left: 3px solid #999; padding-left: 0.8em; font-style: italic; }
+`
+
+var epubpackage = template.Must(template.New("opf").Parse(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="{{.Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">{{.Identifier}}</dc:identifier>
+    <dc:title>{{.Title}}</dc:title>
+    <dc:language>{{.Language}}</dc:language>
+    <dc:creator>ReadEngine</dc:creator>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+    {{- range .Chapters}}
+    <item id="{{.File}}" href="{{.File}}.xhtml" media-type="application/xhtml+xml"/>
+    {{- range .Images}}
+    <item id="{{.Id}}" href="{{.File}}" media-type="{{.MediaType}}"/>
+    {{- end}}
+    {{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="nav" linear="no"/>
+    {{- range .Chapters}}
+    <itemref idref="{{.File}}"/>
+    {{- end}}
+  </spine>
+</package>
+`))
+
+var epubnav = template.Must(template.New("nav").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{.Language}}">
+<head>
+  <meta charset="utf-8"/>
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{.Title}}</h1>
+    <ol>
+      {{- range .Chapters}}
+      <li><a href="{{.File}}.xhtml">{{.Doc.Title}}</a>
+        {{- if .Toc}}{{$c := .}}
+        <ol>
+          {{- range .Toc}}
+          <li><a href="{{$c.File}}.xhtml#s{{.}}">{{(index $c.Sections .).Heading}}</a></li>
+          {{- end}}
+        </ol>
+        {{- end}}
+      </li>
+      {{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+var epubchapter = template.Must(template.New("chapter").Parse(`<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"{{with .Doc.Language}} xml:lang="{{.}}"{{end}}>
+<head>
+  <meta charset="utf-8"/>
+  <title>{{.Doc.Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <section epub:type="chapter">
+    <h1>{{.Doc.Title}}</h1>
+    <p class="meta">
+      {{- with .Doc.Author}}{{.}} · {{end}}<a href="{{.Doc.Src}}">{{.Domain}}</a> · {{.Added}}
+      {{- with .Doc.Tags}} · {{range $i, $t := .}}{{if $i}}, {{end}}{{$t}}{{end}}{{end}}
+    </p>
+    {{- with .Doc.Note}}
+    <p class="note">{{.}}</p>
+    {{- end}}
+    {{- range $i, $s := .Sections}}
+    {{- if $s.Heading}}
+    <h2 id="s{{$i}}">{{$s.Heading}}</h2>
+    {{- end}}
+    {{- range $s.Paragraphs}}
+    <p>{{.}}</p>
+    {{- end}}
+    {{- end}}
+    {{- range .Images}}
+    <figure><img src="{{.File}}" alt=""/></figure>
+    {{- end}}
+  </section>
+</body>
+</html>
+`))
+
+// write_epub writes docs as an epub 3 book with one chapter per doc, images of a doc follow its text
+// since the position of images in content is not kept
+func write_epub(w io.Writer, title string, docs []*Doc) error {
+	hash := sha1.New()
+	chapters := []chapter{}
+	for i, doc := range docs {
+		io.WriteString(hash, doc.Id+"\n")
+		c := chapter{
+			File:     fmt.Sprintf("chapter-%03d", i+1),
+			Doc:      doc,
+			Domain:   doc_domain(doc),
+			Added:    doc_added(doc).Format("2006-01-02"),
+			Sections: doc_sections(doc),
+		}
+		c.Images = chapter_images(c.File, doc)
+		for j, s := range c.Sections {
+			if s.Heading != "" {
+				c.Toc = append(c.Toc, j)
+			}
+		}
+		chapters = append(chapters, c)
+	}
+	book := struct {
+		Identifier string
+		Title      string
+		Language   string
+		Modified   string
+		Chapters   []chapter
+	}{
+		Identifier: fmt.Sprintf("urn:readengine:%x", hash.Sum(nil)),
+		Title:      title,
+		Language:   epub_language(docs),
+		Modified:   time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Chapters:   chapters,
+	}
+
+	z := zip.NewWriter(w)
+	//mimetype must be the first entry and stored uncompressed
+	mimetype, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []epubfile{
+		{name: "META-INF/container.xml", text: epubcontainer},
+		{name: "OEBPS/style.css", text: epubstyle},
+		{name: "OEBPS/content.opf", tmpl: epubpackage, data: book},
+		{name: "OEBPS/nav.xhtml", tmpl: epubnav, data: book},
+	}
+	for _, c := range chapters {
+		files = append(files, epubfile{name: "OEBPS/" + c.File + ".xhtml", tmpl: epubchapter, data: c})
+		for _, image := range c.Images {
+			files = append(files, epubfile{name: "OEBPS/" + image.File, text: string(image.data)})
+		}
+	}
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if file.tmpl == nil {
+			_, err = io.WriteString(f, file.text)
+		} else if _, err = io.WriteString(f, xml.Header); err == nil {
+			//html/template escapes the xml declaration, so it is written here
+			err = file.tmpl.Execute(f, file.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func epub(c *cli.Context) error {
+	since, err := parse_date(c.String("since"), false)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	until, err := parse_date(c.String("until"), true)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	init_engine(c)
+	defer close_engine()
+
+	docs := []*Doc{}
+	if c.NArg() > 0 {
+		for _, id := range c.Args() {
+			doc, err := get_doc(id)
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+			if doc == nil {
+				logrus.Errorf("doc %v not found", id)
+				continue
+			}
+			docs = append(docs, doc)
+		}
+	} else {
+		opts := &publishoptions{
+			Tag:        c.String("tag"),
+			Collection: c.String("collection"),
+			Saved:      c.String("saved"),
+			Since:      since,
+			Until:      until,
+			Limit:      c.Int("limit"),
+		}
+		if docs, err = published_docs(opts); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		//oldest first like a book
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+	if len(docs) == 0 {
+		logrus.Info("未找到数据")
+		return nil
+	}
+
+	title := c.String("title")
+	if title == "" {
+		title = "ReadEngine " + time.Now().Format("2006-01-02")
+	}
+	output := c.String("output")
+	if output == "" {
+		output = "readengine-" + time.Now().Format("20060102") + ".epub"
+	}
+
+	buf := &bytes.Buffer{}
+	if err := write_epub(buf, title, docs); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("wrote %v docs to %v", len(docs), output)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDocSections(t *testing.T) {
+	doc := &Doc{
+		Title:    "Go pipelines",
+		Headings: []string{"Go pipelines", "Fan-out", "Missing", "Stopping short"},
+		Content:  "Intro text. Fan-out Multiple functions read from a channel.\nSecond paragraph. Stopping short Pipelines stop early.",
+	}
+	sections := doc_sections(doc)
+	if len(sections) != 3 {
+		t.Fatalf("expect 3 sections, got %+v", sections)
+	}
+	if sections[0].Heading != "" || sections[0].Paragraphs[0] != "Intro text." {
+		t.Errorf("unexpected first section %+v", sections[0])
+	}
+	if sections[1].Heading != "Fan-out" || len(sections[1].Paragraphs) != 2 {
+		t.Errorf("unexpected second section %+v", sections[1])
+	}
+	if sections[2].Heading != "Stopping short" || sections[2].Paragraphs[0] != "Pipelines stop early." {
+		t.Errorf("unexpected third section %+v", sections[2])
+	}
+}
+
+func TestWriteEpub(t *testing.T) {
+	//images are served by a stub, unsupported and failing ones are left out
+	fetch := fetch_image
+	defer func() { fetch_image = fetch }()
+	fetch_image = func(url string) ([]byte, string, error) {
+		switch url {
+		case "https://blog.golang.org/pipelines.png":
+			return []byte("\x89PNG"), "image/png", nil
+		case "https://blog.golang.org/pipelines.tiff":
+			return []byte("II*"), "image/tiff", nil
+		}
+		return nil, "", errors.New("not found")
+	}
+
+	docs := []*Doc{
+		{Id: "1514764800", Src: "https://blog.golang.org/pipelines?a=1&b=2", Title: "Go pipelines <&>", Author: "Sameer Ajmani", Language: "en",
+			Headings: []string{"Fan-out"}, Content: "Intro. Fan-out Many readers.", Tags: []string{"go"}, Note: "read again",
+			Images: []string{"https://blog.golang.org/pipelines.png", "https://blog.golang.org/pipelines.tiff", "https://blog.golang.org/missing.png"}},
+		{Id: "1514851200", Src: "https://example.com/zh", Title: "中文", Language: "zh", Content: "第一段\n第二段"},
+	}
+	buf := &bytes.Buffer{}
+	if err := write_epub(buf, "Reading list", docs); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.File[0].Name != "mimetype" || z.File[0].Method != zip.Store {
+		t.Errorf("mimetype must be the first stored entry, got %v", z.File[0].Name)
+	}
+
+	files := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+		if strings.HasSuffix(f.Name, ".xhtml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xml") {
+			if !bytes.HasPrefix(content, []byte("<?xml ")) {
+				t.Errorf("%v should start with xml declaration", f.Name)
+			}
+			decoder := xml.NewDecoder(bytes.NewReader(content))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Errorf("%v is not well formed: %v\n%s", f.Name, err, content)
+					break
+				}
+			}
+		}
+	}
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("unexpected mimetype %q", files["mimetype"])
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/chapter-001.xhtml", "OEBPS/chapter-002.xhtml", "OEBPS/images/chapter-001-img-01.png"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %v", name)
+		}
+	}
+	chapter := files["OEBPS/chapter-001.xhtml"]
+	for _, expect := range []string{"Sameer Ajmani", `href="https://blog.golang.org/pipelines?a=1&amp;b=2"`, `<h2 id="s1">Fan-out</h2>`, "read again", `<img src="images/chapter-001-img-01.png" alt=""/>`} {
+		if !strings.Contains(chapter, expect) {
+			t.Errorf("expect %v in chapter\n%v", expect, chapter)
+		}
+	}
+	if len(files) != 8 {
+		t.Errorf("expect 8 files, got %v", len(files))
+	}
+	if !strings.Contains(files["OEBPS/content.opf"], `<item id="chapter-001-img-01" href="images/chapter-001-img-01.png" media-type="image/png"/>`) {
+		t.Errorf("expect image in manifest\n%v", files["OEBPS/content.opf"])
+	}
+	if !strings.Contains(files["OEBPS/nav.xhtml"], `chapter-001.xhtml#s1`) {
+		t.Errorf("expect headings in toc\n%v", files["OEBPS/nav.xhtml"])
+	}
+}
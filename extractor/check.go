@@ -0,0 +1,88 @@
+package extractor
+
+import (
+	"net/http"
+)
+
+// CheckResult is the outcome of revisiting a previously indexed url.
+type CheckResult struct {
+	// StatusCode is the http status code of the response.
+	StatusCode int
+
+	// Location is the redirect target when StatusCode is a redirection.
+	Location string
+
+	// ETag and LastModified are the validators returned by the server,
+	// they should be sent back on the next check.
+	ETag         string
+	LastModified string
+
+	// NotModified is true when the server answered 304 to the conditional request.
+	NotModified bool
+
+	// Title and Content are the extracted title and main content,
+	// only filled when the page is returned with 200.
+	Title   string
+	Content string
+}
+
+var checkClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Check requests src with a conditional GET using etag and lastModified
+// from the previous check. Redirects are not followed so that moved pages
+// can be reported.
+func Check(src string, etag string, lastModified string) (*CheckResult, error) {
+	req, err := newRequest(http.MethodGet, src)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := do(checkClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &CheckResult{
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		result.NotModified = true
+		if result.ETag == "" {
+			result.ETag = etag
+		}
+		if result.LastModified == "" {
+			result.LastModified = lastModified
+		}
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		if loc, err := resp.Location(); err == nil {
+			result.Location = loc.String()
+		}
+	case resp.StatusCode == http.StatusOK:
+		page, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		content, err := parse(page, src)
+		if err != nil {
+			return nil, err
+		}
+		result.Title, result.Content = content.Title, content.Description
+	}
+
+	return result, nil
+}
@@ -41,60 +41,103 @@ func init() {
 }
 
 func Parse(src string) (string, string, error) {
+	content, err := ParseContent(src)
+	if err != nil {
+		return "", "", err
+	}
+	return content.Title, content.Description, nil
+}
+
+// ParseContent requests src and returns everything extracted from the page
+func ParseContent(src string) (*Content, error) {
 	//get page content
 	page, err := request(src)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
+	return parse(page, src)
+}
+
+func parse(page []byte, src string) (*Content, error) {
 	//replace comment blocks
 	regx, _ := regexp.Compile(`<!--.+-->`)
 	page = regx.ReplaceAll(page, nil)
 
 	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	//extract
-	content, err := ExtractFromDocument(doc, src, o)
+	return ExtractFromDocument(doc, src, o)
+}
+
+func request(rawUrl string) ([]byte, error) {
+	req, err := newRequest(http.MethodGet, rawUrl)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	return content.Title, content.Description, nil
+
+	resp, err := do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	return readBody(resp)
 }
 
-func request(rawUrl string) ([]byte, error) {
+// StatusError is returned when a page is answered with a status other than 2xx.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+func newRequest(method string, rawUrl string) (*http.Request, error) {
 	u, err := url.Parse(rawUrl)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	req, err := http.NewRequest(method, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header = header
+	for k, v := range header {
+		req.Header[k] = v
+	}
 	req.Header.Set("Host", u.Host)
 	req.Header.Set("Referer", u.Scheme+"://"+u.Host)
+	return req, nil
+}
 
-	resp, err := client.Do(req)
+func readBody(resp *http.Response) ([]byte, error) {
+	x, err := uncompress(resp)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return decode(x)
+}
+
+// uncompress returns body of resp decoded by its Content-Encoding
+func uncompress(resp *http.Response) (io.Reader, error) {
 	contentEncoding := strings.Trim(strings.ToLower(resp.Header.Get("Content-Encoding")), " ")
-	var x io.Reader
 	if contentEncoding == "gzip" {
-		x, err = gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+		return gzip.NewReader(resp.Body)
 	} else if contentEncoding == "deflate" {
-		x = flate.NewReader(resp.Body)
-	} else {
-		x = resp.Body
+		return flate.NewReader(resp.Body), nil
 	}
+	return resp.Body, nil
+}
 
+func decode(x io.Reader) ([]byte, error) {
 	bs, err := ioutil.ReadAll(x)
 	if err != nil {
 		return nil, err
@@ -106,16 +149,9 @@ func request(rawUrl string) ([]byte, error) {
 		charset = strings.ToLower(string(tmp[1]))
 	}
 	if charset != "utf8" && charset != "utf-8" {
-		var decoder *encoding.Decoder
-		switch charset {
-		case "gbk":
-			decoder = simplifiedchinese.GBK.NewDecoder()
-		case "gb2312":
-			decoder = simplifiedchinese.HZGB2312.NewDecoder()
-		case "gb18030":
-			decoder = simplifiedchinese.GB18030.NewDecoder()
-		default:
-			return nil, errors.New(charset + " not support")
+		decoder, err := charsetDecoder(charset)
+		if err != nil {
+			return nil, err
 		}
 		trans := transform.NewReader(bytes.NewReader(bs), decoder)
 		return ioutil.ReadAll(trans)
@@ -123,3 +159,16 @@ func request(rawUrl string) ([]byte, error) {
 		return bs, nil
 	}
 }
+
+// charsetDecoder returns decoder of a chinese charset
+func charsetDecoder(charset string) (*encoding.Decoder, error) {
+	switch charset {
+	case "gbk":
+		return simplifiedchinese.GBK.NewDecoder(), nil
+	case "gb2312":
+		return simplifiedchinese.HZGB2312.NewDecoder(), nil
+	case "gb18030":
+		return simplifiedchinese.GB18030.NewDecoder(), nil
+	}
+	return nil, errors.New(charset + " not support")
+}
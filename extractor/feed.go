@@ -0,0 +1,356 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Feed is a RSS 2.0, Atom or JSON Feed document.
+type Feed struct {
+	Title   string
+	Link    string
+	Entries []FeedEntry
+}
+
+// FeedEntry is an item of a feed.
+type FeedEntry struct {
+	// GUID identifies the entry, it falls back to Link when the feed has no id.
+	GUID  string
+	Link  string
+	Title string
+
+	// Content is the full content of the entry when the feed carries it
+	// (content:encoded, Atom content, content_html or content_text),
+	// Summary is the description or summary.
+	Content string
+	Summary string
+
+	Author    string
+	Published time.Time
+}
+
+// FeedResult is the outcome of fetching a feed with a conditional request.
+type FeedResult struct {
+	// ETag and LastModified should be sent back on the next fetch.
+	ETag         string
+	LastModified string
+
+	// NotModified is true when the server answered 304, Feed is nil then.
+	NotModified bool
+
+	Feed *Feed
+}
+
+var ErrUnknownFeed = errors.New("not a rss, atom or json feed")
+
+// FetchFeed requests feed src with a conditional GET using etag and lastModified
+// from the previous fetch.
+func FetchFeed(src string, etag string, lastModified string) (*FeedResult, error) {
+	req, err := newRequest(http.MethodGet, src)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &FeedResult{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		result.NotModified = true
+		if result.ETag == "" {
+			result.ETag = etag
+		}
+		if result.LastModified == "" {
+			result.LastModified = lastModified
+		}
+		return result, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New(resp.Status)
+	}
+
+	x, err := uncompress(resp)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(x)
+	if err != nil {
+		return nil, err
+	}
+	result.Feed, err = ParseFeed(data, src)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ParseFeed parses RSS 2.0, Atom or JSON Feed, relative links are resolved against src.
+func ParseFeed(data []byte, src string) (*Feed, error) {
+	trimmed := bytes.TrimSpace(data)
+	var feed *Feed
+	var err error
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		feed, err = parseJSONFeed(trimmed)
+	} else {
+		feed, err = parseXMLFeed(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range feed.Entries {
+		entry := &feed.Entries[i]
+		if entry.Link != "" {
+			if link, err := absPath(entry.Link, src); err == nil {
+				entry.Link = link
+			}
+		}
+		if entry.GUID == "" {
+			entry.GUID = entry.Link
+		}
+	}
+	return feed, nil
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			Description string `xml:"description"`
+			Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			Author      string `xml:"author"`
+			Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name   `xml:"feed"`
+	Title   string     `xml:"title"`
+	Links   []atomLink `xml:"link"`
+	Entries []struct {
+		Title     string     `xml:"title"`
+		Links     []atomLink `xml:"link"`
+		ID        string     `xml:"id"`
+		Summary   string     `xml:"summary"`
+		Content   string     `xml:"content"`
+		Author    string     `xml:"author>name"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+	} `xml:"entry"`
+}
+
+func parseXMLFeed(data []byte) (*Feed, error) {
+	//detect root element
+	root := ""
+	decoder := newXMLDecoder(data)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, ErrUnknownFeed
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start.Name.Local
+			break
+		}
+	}
+
+	switch root {
+	case "rss":
+		rss := rssFeed{}
+		if err := newXMLDecoder(data).Decode(&rss); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(rss.Channel.Title), Link: strings.TrimSpace(rss.Channel.Link)}
+		for _, item := range rss.Channel.Items {
+			author := item.Creator
+			if author == "" {
+				author = item.Author
+			}
+			feed.Entries = append(feed.Entries, FeedEntry{
+				GUID:      strings.TrimSpace(item.GUID),
+				Link:      strings.TrimSpace(item.Link),
+				Title:     strings.TrimSpace(item.Title),
+				Content:   strings.TrimSpace(item.Content),
+				Summary:   strings.TrimSpace(item.Description),
+				Author:    strings.TrimSpace(author),
+				Published: parseFeedTime(item.PubDate),
+			})
+		}
+		return feed, nil
+	case "feed":
+		atom := atomFeed{}
+		if err := newXMLDecoder(data).Decode(&atom); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(atom.Title), Link: atomAlternate(atom.Links)}
+		for _, entry := range atom.Entries {
+			published := parseFeedTime(entry.Published)
+			if published.IsZero() {
+				published = parseFeedTime(entry.Updated)
+			}
+			feed.Entries = append(feed.Entries, FeedEntry{
+				GUID:      strings.TrimSpace(entry.ID),
+				Link:      atomAlternate(entry.Links),
+				Title:     strings.TrimSpace(entry.Title),
+				Content:   strings.TrimSpace(entry.Content),
+				Summary:   strings.TrimSpace(entry.Summary),
+				Author:    strings.TrimSpace(entry.Author),
+				Published: published,
+			})
+		}
+		return feed, nil
+	}
+	return nil, ErrUnknownFeed
+}
+
+// newXMLDecoder decodes feeds in chinese charsets besides utf-8
+func newXMLDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		decoder, err := charsetDecoder(strings.ToLower(charset))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.Reader(input), nil
+	}
+	return decoder
+}
+
+// atomAlternate returns the alternate link, which is the link without rel
+func atomAlternate(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+type jsonFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	Items       []struct {
+		ID            interface{} `json:"id"`
+		URL           string      `json:"url"`
+		Title         string      `json:"title"`
+		ContentHTML   string      `json:"content_html"`
+		ContentText   string      `json:"content_text"`
+		Summary       string      `json:"summary"`
+		DatePublished string      `json:"date_published"`
+		Author        struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"items"`
+}
+
+func parseJSONFeed(data []byte) (*Feed, error) {
+	jf := jsonFeed{}
+	if err := json.Unmarshal(data, &jf); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(jf.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrUnknownFeed
+	}
+	feed := &Feed{Title: strings.TrimSpace(jf.Title), Link: jf.HomePageURL}
+	for _, item := range jf.Items {
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+		guid := ""
+		if item.ID != nil {
+			guid = strings.TrimSpace(strings.Trim(jsonString(item.ID), `"`))
+		}
+		feed.Entries = append(feed.Entries, FeedEntry{
+			GUID:      guid,
+			Link:      strings.TrimSpace(item.URL),
+			Title:     strings.TrimSpace(item.Title),
+			Content:   strings.TrimSpace(content),
+			Summary:   strings.TrimSpace(item.Summary),
+			Author:    strings.TrimSpace(item.Author.Name),
+			Published: parseFeedTime(item.DatePublished),
+		})
+	}
+	return feed, nil
+}
+
+// jsonString formats a json id which may be a string or a number
+func jsonString(v interface{}) string {
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
+
+var feedTimeFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, format := range feedTimeFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// HTMLText returns text of a html fragment such as the content of a feed entry.
+func HTMLText(fragment string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+	if err != nil {
+		return fragment
+	}
+	doc.Find("script, style").Remove()
+	text := []string{}
+	doc.Find("body").Contents().Each(func(i int, s *goquery.Selection) {
+		if t := strings.Join(strings.Fields(s.Text()), " "); t != "" {
+			text = append(text, t)
+		}
+	})
+	return strings.Join(text, "\n")
+}
@@ -0,0 +1,45 @@
+package extractor
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// max size of an image fetched by FetchImage
+const imageLimit = 10 * 1024 * 1024
+
+// FetchImage requests image src and returns its data with its media type,
+// which is sniffed from the data when the response does not tell an image type.
+func FetchImage(src string) ([]byte, string, error) {
+	req, err := newRequest(http.MethodGet, src)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/webp,image/*,*/*;q=0.8")
+
+	resp, err := do(client, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	x, err := uncompress(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(x, imageLimit))
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return data, mediaType, nil
+}
@@ -0,0 +1,346 @@
+package extractor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Politeness limits how hard requests hit each host. The zero value sends
+// requests right away like a plain http client.
+type Politeness struct {
+	// Robots makes requests honor robots.txt of the host and its Crawl-delay.
+	Robots bool
+
+	// Agent is the name matched against User-agent lines of robots.txt,
+	// rules for * apply when no group names it.
+	Agent string
+
+	// HostConcurrency is the max number of requests in flight to a host, 0 for no limit.
+	HostConcurrency int
+
+	// HostRPS is the max number of requests per second to a host, 0 for no limit.
+	HostRPS float64
+
+	// MaxRetryAfter is the longest Retry-After of a 429 or 503 response waited for
+	// before the request is retried once, longer ones are returned as they are.
+	MaxRetryAfter time.Duration
+}
+
+// ErrDisallowed is returned for urls robots.txt disallows.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// ErrRobotsUnavailable is returned for urls of a host whose robots.txt cannot be fetched
+// or answers with a server error, which disallows everything until it is fetched again.
+var ErrRobotsUnavailable = errors.New("robots.txt unavailable")
+
+// robots.txt is fetched again after robotsTTL, or after robotsRetryTTL when it was unavailable
+const (
+	robotsTTL      = 24 * time.Hour
+	robotsRetryTTL = time.Minute
+)
+
+var (
+	politeness Politeness
+	hostsLock  sync.Mutex
+	hosts      = map[string]*hostState{}
+)
+
+// SetPoliteness sets limits of all following requests.
+func SetPoliteness(p Politeness) {
+	hostsLock.Lock()
+	defer hostsLock.Unlock()
+	politeness = p
+	hosts = map[string]*hostState{}
+}
+
+type hostState struct {
+	sync.Mutex
+	slots chan struct{}
+	// next is the earliest time of the next request
+	next      time.Time
+	robots    *robotsRules
+	robotsAt  time.Time
+	robotsErr error
+}
+
+func getHostState(host string) (*hostState, Politeness) {
+	hostsLock.Lock()
+	defer hostsLock.Unlock()
+	st, ok := hosts[host]
+	if !ok {
+		st = &hostState{}
+		if politeness.HostConcurrency > 0 {
+			st.slots = make(chan struct{}, politeness.HostConcurrency)
+		}
+		hosts[host] = st
+	}
+	return st, politeness
+}
+
+// do sends req with client within the limits of its host, the host slot is
+// held until the body of the response is closed
+func do(client *http.Client, req *http.Request) (*http.Response, error) {
+	st, p := getHostState(req.URL.Host)
+	if p == (Politeness{}) {
+		return client.Do(req)
+	}
+
+	delay := time.Duration(0)
+	if p.Robots {
+		rules, err := st.rules(req)
+		if err != nil {
+			return nil, ErrRobotsUnavailable
+		}
+		if !rules.allowed(req.URL.RequestURI()) {
+			return nil, ErrDisallowed
+		}
+		delay = rules.crawlDelay
+	}
+	if p.HostRPS > 0 {
+		if interval := time.Duration(float64(time.Second) / p.HostRPS); interval > delay {
+			delay = interval
+		}
+	}
+
+	if st.slots != nil {
+		st.slots <- struct{}{}
+	}
+	release := func() {
+		if st.slots != nil {
+			<-st.slots
+		}
+	}
+
+	for retried := false; ; retried = true {
+		time.Sleep(st.reserve(delay, time.Now()))
+		resp, err := client.Do(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if ok {
+			st.postpone(time.Now().Add(wait))
+		}
+		if retried || !ok || wait > p.MaxRetryAfter {
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// reserve takes the next request slot of the host, delay apart from the previous one,
+// and returns how long to wait for it
+func (st *hostState) reserve(delay time.Duration, now time.Time) time.Duration {
+	st.Lock()
+	defer st.Unlock()
+	slot := now
+	if st.next.After(now) {
+		slot = st.next
+	}
+	st.next = slot.Add(delay)
+	return slot.Sub(now)
+}
+
+// postpone makes no request to the host before t
+func (st *hostState) postpone(t time.Time) {
+	st.Lock()
+	defer st.Unlock()
+	if t.After(st.next) {
+		st.next = t
+	}
+}
+
+// rules returns robots.txt rules of the host of req, fetched when missing or expired.
+// robots.txt is fetched following redirects whatever client sends req, the error of
+// one that cannot be fetched is returned until it is fetched again.
+func (st *hostState) rules(req *http.Request) (*robotsRules, error) {
+	st.Lock()
+	defer st.Unlock()
+	if st.robotsErr != nil && time.Since(st.robotsAt) < robotsRetryTTL {
+		return nil, st.robotsErr
+	}
+	if st.robots != nil && time.Since(st.robotsAt) < robotsTTL {
+		return st.robots, nil
+	}
+	st.robots, st.robotsErr = fetchRobots(client, req.URL.Scheme+"://"+req.URL.Host+"/robots.txt", politeness.Agent)
+	st.robotsAt = time.Now()
+	return st.robots, st.robotsErr
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// retryAfter parses Retry-After given as seconds or http date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if t.Before(now) {
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+	match   *regexp.Regexp
+}
+
+// robotsRules are the rules of the group of robots.txt that applies to an agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+func fetchRobots(client *http.Client, src string, agent string) (*robotsRules, error) {
+	req, err := newRequest(http.MethodGet, src)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("robots.txt %v: %v", src, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		//missing robots.txt allows everything
+		return &robotsRules{}, nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, 512*1024), agent), nil
+}
+
+// parseRobots returns the rules of the group naming agent, or of the * group
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	named, wildcard := (*robotsRules)(nil), (*robotsRules)(nil)
+
+	var current []*robotsRules
+	ingroup := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pos := strings.Index(line, "#"); pos >= 0 {
+			line = line[:pos]
+		}
+		pos := strings.Index(line, ":")
+		if pos < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:pos]))
+		value := strings.TrimSpace(line[pos+1:])
+
+		switch key {
+		case "user-agent":
+			//consecutive user-agent lines share a group
+			if ingroup {
+				current = nil
+				ingroup = false
+			}
+			ua := strings.ToLower(value)
+			switch {
+			case ua == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case agent != "" && strings.Contains(agent, ua):
+				if named == nil {
+					named = &robotsRules{}
+				}
+				current = append(current, named)
+			}
+		case "allow", "disallow":
+			ingroup = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value, match: robotsPattern(value)}
+			for _, group := range current {
+				group.rules = append(group.rules, rule)
+			}
+		case "crawl-delay":
+			ingroup = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				for _, group := range current {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if named != nil {
+		return named
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsPattern compiles a path pattern with * and a trailing $
+func robotsPattern(pattern string) *regexp.Regexp {
+	end := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if end {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether path may be requested, the longest matching rule wins
+// and allow wins a tie
+func (r *robotsRules) allowed(path string) bool {
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.match.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
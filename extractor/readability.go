@@ -181,7 +181,12 @@ type Content struct {
 	Title       string
 	Description string
 	Author      string
+	Headings    []string
 	Images      []Image
+	Links       []string
+
+	// Published is when the page says it was published, zero when it does not.
+	Published time.Time
 }
 
 // Extract requests to reqURL then returns contents extracted from the response.
@@ -200,14 +205,72 @@ func Extract(reqURL string, opt *Option) (*Content, error) {
 // otherwise use Extract(reqURL, opt).
 func ExtractFromDocument(doc *goquery.Document, reqURL string, opt *Option) (*Content, error) {
 	title := strings.TrimSpace(doc.Find("title").First().Text())
+	heads := headings(doc, title)
+	//links are collected before the page is trimmed to the article
+	hrefs := links(doc, reqURL)
 	return &Content{
 		Title:       title,
+		Headings:    heads,
 		Description: description(doc, opt),
 		Author:      author(doc),
+		Published:   published(doc),
 		Images:      images(doc, reqURL, opt),
+		Links:       hrefs,
 	}, nil
 }
 
+// links returns absolute http and https urls the page links to without fragments, each once.
+// Links marked nofollow are skipped.
+func links(doc *goquery.Document, reqURL string) []string {
+	base, err := url.Parse(reqURL)
+	if err != nil {
+		return nil
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+		}
+	}
+	hrefs := []string{}
+	seen := map[string]bool{}
+	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		if strings.Contains(strings.ToLower(s.AttrOr("rel", "")), "nofollow") {
+			return
+		}
+		u, err := base.Parse(strings.TrimSpace(s.AttrOr("href", "")))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		href := u.String()
+		if !seen[href] {
+			seen[href] = true
+			hrefs = append(hrefs, href)
+		}
+	})
+	return hrefs
+}
+
+// headings returns text of h1-h4 inside the article element if any, otherwise in the whole page.
+// Empty headings and those repeating the title are skipped.
+func headings(doc *goquery.Document, title string) []string {
+	root := doc.Find("article").First()
+	if root.Length() == 0 {
+		root = doc.Selection
+	}
+	heads := []string{}
+	seen := map[string]bool{title: true}
+	root.Find("h1, h2, h3, h4").Each(func(i int, s *goquery.Selection) {
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		if text == "" || seen[text] {
+			return
+		}
+		seen[text] = true
+		heads = append(heads, text)
+	})
+	return heads
+}
+
 func description(doc *goquery.Document, opt *Option) string {
 	candidates, err := prepareCandidates(doc, opt)
 	if err != nil {
@@ -660,6 +723,8 @@ func images(doc *goquery.Document, reqURL string, opt *Option) []Image {
 	ch := make(chan *Image)
 	imgs := []Image{}
 	loopCnt := uint(0)
+	// number of image checks not reported yet
+	pending := 0
 	fi := fastimage.NewFastImage(opt.ImageRequestTimeout, nil)
 	doc.Find("img").EachWithBreak(func(i int, s *goquery.Selection) bool {
 		if loopCnt >= opt.CheckImageLoopCount {
@@ -679,6 +744,7 @@ func images(doc *goquery.Document, reqURL string, opt *Option) []Image {
 			fmt.Printf("loopCnt: %v, src: %v, w: %v, h: %v\n", loopCnt, src, w, h)
 		}
 
+		pending++
 		go func(lc *uint) {
 			defer func() {
 				if err := recover(); err != nil {
@@ -693,9 +759,10 @@ func images(doc *goquery.Document, reqURL string, opt *Option) []Image {
 	})
 
 	timeout := time.After(time.Duration(opt.ImageRequestTimeout+50) * time.Millisecond)
-	for {
+	for pending > 0 {
 		select {
 		case result := <-ch:
+			pending--
 			if result.Size != nil &&
 				result.Size.Width >= opt.MinImageWidth &&
 				result.Size.Height >= opt.MinImageHeight {
@@ -708,6 +775,7 @@ func images(doc *goquery.Document, reqURL string, opt *Option) []Image {
 			return imgs
 		}
 	}
+	return imgs
 }
 
 func isSupportedImage(src string, opt *Option) bool {
@@ -741,6 +809,25 @@ func checkImageSize(fi *fastimage.FastImage, src string, widthFromAttr, heightFr
 	}
 }
 
+// published returns the publish time given by meta tags, microdata or the first time tag of the page
+func published(doc *goquery.Document) time.Time {
+	for _, selector := range []string{
+		`meta[property="article:published_time"]`,
+		`meta[name="pubdate"]`,
+		`meta[name="date"]`,
+		`meta[name="dc.date"]`,
+		`meta[itemprop="datePublished"]`,
+	} {
+		if t := parseFeedTime(doc.Find(selector).First().AttrOr("content", "")); !t.IsZero() {
+			return t
+		}
+	}
+	if t := parseFeedTime(doc.Find("time[datetime]").First().AttrOr("datetime", "")); !t.IsZero() {
+		return t
+	}
+	return time.Time{}
+}
+
 func author(doc *goquery.Document) string {
 	var author string
 	var found bool
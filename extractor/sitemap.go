@@ -0,0 +1,110 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sitemap is a sitemap.xml urlset or a sitemap index.
+type Sitemap struct {
+	// URLs are pages listed by an urlset.
+	URLs []SitemapEntry
+
+	// Sitemaps are other sitemaps listed by a sitemap index.
+	Sitemaps []SitemapEntry
+}
+
+// SitemapEntry is a loc of a sitemap with its lastmod, LastMod is zero when missing.
+type SitemapEntry struct {
+	Loc     string
+	LastMod time.Time
+}
+
+var ErrUnknownSitemap = errors.New("not a sitemap or sitemap index")
+
+// max size of a sitemap after decompression, the protocol limits it to 50MB
+const sitemapLimit = 50 * 1024 * 1024
+
+// FetchSitemap requests and parses sitemap src, gzip compressed files are decompressed.
+func FetchSitemap(src string) (*Sitemap, error) {
+	req, err := newRequest(http.MethodGet, src)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/xml, text/xml;q=0.9, */*;q=0.8")
+
+	resp, err := do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	x, err := uncompress(resp)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(x, sitemapLimit))
+	if err != nil {
+		return nil, err
+	}
+	return ParseSitemap(data)
+}
+
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// ParseSitemap parses an urlset or a sitemap index, which may be gzip compressed.
+func ParseSitemap(data []byte) (*Sitemap, error) {
+	//.xml.gz files are usually served as they are instead of with Content-Encoding
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(io.LimitReader(r, sitemapLimit))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var doc sitemapXML
+	if err := newXMLDecoder(data).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, ErrUnknownSitemap
+	}
+
+	sitemap := &Sitemap{}
+	sitemap.URLs = sitemapEntries(doc.URLs)
+	sitemap.Sitemaps = sitemapEntries(doc.Sitemaps)
+	return sitemap, nil
+}
+
+func sitemapEntries(locs []sitemapLoc) []SitemapEntry {
+	entries := []SitemapEntry{}
+	for _, loc := range locs {
+		if l := strings.TrimSpace(loc.Loc); l != "" {
+			entries = append(entries, SitemapEntry{Loc: l, LastMod: parseFeedTime(loc.LastMod)})
+		}
+	}
+	return entries
+}
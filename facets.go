@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// facets of search results, each term comes with the filter to drill down into it
+var facetfields = []struct {
+	Name  string
+	Field string
+}{
+	{"site", "Domain"},
+	{"month", "Added"},
+	{"author", "Author"},
+	{"lang", "Language"},
+}
+
+// max number of months counted by the month facet
+const maxmonths = 36
+
+const monthformat = "2006-01"
+
+type facetresult struct {
+	Name  string
+	Terms []facetterm
+}
+
+type facetterm struct {
+	Term   string
+	Count  int
+	Filter string
+}
+
+// added_range returns when the first and the last indexed doc were added, zero times if there is none
+func added_range() (time.Time, time.Time, error) {
+	added := []time.Time{}
+	for _, order := range []string{"Added", "-Added"} {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1, 0, false)
+		req.SortBy([]string{order})
+		res, err := idx.Search(req)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if len(res.Hits) == 0 {
+			return time.Time{}, time.Time{}, nil
+		}
+		added = append(added, doc_added(&Doc{Id: res.Hits[0].ID}))
+	}
+	return added[0], added[1], nil
+}
+
+// add_facets requests facets of results, months between since and until,
+// which default to the months of the first and the last doc
+func add_facets(req *bleve.SearchRequest, opts *searchoptions) error {
+	size := opts.FacetSize
+	if size <= 0 {
+		size = 10
+	}
+	for _, facet := range facetfields {
+		if facet.Name != "month" {
+			req.AddFacet(facet.Name, bleve.NewFacetRequest(facet.Field, size))
+			continue
+		}
+
+		start, end := opts.Since, opts.Until
+		if start.IsZero() || end.IsZero() {
+			first, last, err := added_range()
+			if err != nil {
+				return err
+			}
+			if start.IsZero() {
+				start = first
+			}
+			if end.IsZero() {
+				end = last
+			}
+		}
+		ranges := month_ranges(start, end, maxmonths)
+		if len(ranges) == 0 {
+			continue
+		}
+		months := bleve.NewFacetRequest(facet.Field, maxmonths)
+		for _, month := range ranges {
+			months.AddDateTimeRange(month.Format(monthformat), month, month.AddDate(0, 1, 0))
+		}
+		req.AddFacet(facet.Name, months)
+	}
+	return nil
+}
+
+// month_ranges returns the first day of each month between start and end, the latest max months at most
+func month_ranges(start, end time.Time, max int) []time.Time {
+	if start.IsZero() || end.Before(start) {
+		return nil
+	}
+	first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local)
+	last := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.Local)
+	months := []time.Time{}
+	for month := last; !month.Before(first) && len(months) < max; month = month.AddDate(0, -1, 0) {
+		months = append(months, month)
+	}
+	return months
+}
+
+// month_query matches docs added in month given as 2006-01
+func month_query(month string) (query.Query, error) {
+	start, err := time.ParseInLocation(monthformat, month, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	q := bleve.NewDateRangeQuery(start, start.AddDate(0, 1, 0))
+	q.SetField("Added")
+	return q, nil
+}
+
+// facet_results converts facets of res in the order of facetfields, months are sorted by date
+func facet_results(res *bleve.SearchResult) []facetresult {
+	results := []facetresult{}
+	for _, facet := range facetfields {
+		f, ok := res.Facets[facet.Name]
+		if !ok {
+			continue
+		}
+		result := facetresult{Name: facet.Name, Terms: []facetterm{}}
+		if facet.Name == "month" {
+			for _, r := range f.DateRanges {
+				if r.Count > 0 {
+					result.Terms = append(result.Terms, facetterm{Term: r.Name, Count: r.Count, Filter: "month:" + r.Name})
+				}
+			}
+			sort.Slice(result.Terms, func(i, j int) bool {
+				return result.Terms[i].Term > result.Terms[j].Term
+			})
+		} else {
+			for _, t := range f.Terms {
+				if t.Term == "" {
+					continue
+				}
+				result.Terms = append(result.Terms, facetterm{Term: t.Term, Count: t.Count, Filter: facet_filter(facet.Name, t.Term)})
+			}
+		}
+		if len(result.Terms) > 0 {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// facet_filter is the filter to add to keyword to drill down into term
+func facet_filter(name, term string) string {
+	if strings.ContainsAny(term, " \"") {
+		return name + ":" + strconv.Quote(term)
+	}
+	return name + ":" + term
+}
+
+func print_facets(facets []facetresult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, facet := range facets {
+		for i, term := range facet.Terms {
+			name := ""
+			if i == 0 {
+				name = facet.Name
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", name, term.Count, term.Filter)
+		}
+	}
+	w.Flush()
+}
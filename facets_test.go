@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthRanges(t *testing.T) {
+	start := time.Date(2017, 11, 20, 0, 0, 0, 0, time.Local)
+	end := time.Date(2018, 2, 3, 0, 0, 0, 0, time.Local)
+	months := month_ranges(start, end, 36)
+	names := []string{}
+	for _, month := range months {
+		names = append(names, month.Format(monthformat))
+	}
+	if len(names) != 4 || names[0] != "2018-02" || names[3] != "2017-11" {
+		t.Errorf("unexpected months %v", names)
+	}
+	if months := month_ranges(start, end, 2); len(months) != 2 {
+		t.Errorf("expect 2 latest months, got %v", months)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1521072000", Src: "https://medium.com/a", Title: "Go pipelines", Author: "Rob Pike", Language: "en"},
+		{Id: "1523750400", Src: "https://medium.com/b", Title: "Go worker pools", Language: "en"},
+		{Id: "1526342400", Src: "https://blog.golang.org/c", Title: "Go modules", Author: "Rob Pike", Language: "en"},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if first, last, err := added_range(); err != nil || first.Unix() != 1521072000 || last.Unix() != 1526342400 {
+		t.Errorf("unexpected range of added %v %v %v", first, last, err)
+	}
+
+	res, err := run_search(&searchoptions{Keyword: "go", Boost: default_boost(), Facets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	facets := map[string][]facetterm{}
+	for _, facet := range facet_results(res) {
+		facets[facet.Name] = facet.Terms
+	}
+	if terms := facets["site"]; len(terms) != 2 || terms[0].Term != "medium.com" || terms[0].Count != 2 {
+		t.Errorf("unexpected site facet %+v", terms)
+	}
+	if terms := facets["author"]; len(terms) != 1 || terms[0].Filter != `author:"Rob Pike"` || terms[0].Count != 2 {
+		t.Errorf("unexpected author facet %+v", terms)
+	}
+	if terms := facets["month"]; len(terms) != 3 {
+		t.Errorf("unexpected month facet %+v", terms)
+	}
+
+	//drill down with the printed filters
+	res, err = run_search(&searchoptions{Keyword: `go author:"Rob Pike" ` + facets["month"][0].Filter, Boost: default_boost()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "1526342400" {
+		t.Errorf("unexpected drill down %v", res.Hits)
+	}
+}
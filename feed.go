@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Subscription is a feed polled for new entries, kept in the feeds bucket keyed by Url,
+// GUIDs of entries already seen are kept in the feedseen bucket keyed by Url and GUID
+type Subscription struct {
+	Url     string
+	Title   string
+	AddedAt int64
+
+	//from the last poll, sent back as conditional request
+	ETag         string
+	LastModified string
+	CheckedAt    int64
+	Error        string
+}
+
+func put_feed(sub *Subscription) error {
+	return db.Update(func(tx *Tx) error {
+		bs, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+		return tx.Put("feeds", sub.Url, bs)
+	})
+}
+
+// get_feed loads subscription by url, returns nil if not found
+func get_feed(url string) (*Subscription, error) {
+	var sub *Subscription
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("feeds", url)
+		if err != nil || v == nil {
+			return err
+		}
+		sub = &Subscription{}
+		return json.Unmarshal(v, sub)
+	})
+	return sub, err
+}
+
+func list_feeds() ([]*Subscription, error) {
+	subs := []*Subscription{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("feeds", "", func(k string, v []byte) error {
+			sub := &Subscription{}
+			if err := json.Unmarshal(v, sub); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			subs = append(subs, sub)
+			return nil
+		})
+	})
+	return subs, err
+}
+
+// del_feed removes subscription by url together with its seen entries, reports whether it existed
+func del_feed(url string) (bool, error) {
+	found := false
+	err := db.Update(func(tx *Tx) error {
+		v, err := tx.Get("feeds", url)
+		if err != nil {
+			return err
+		}
+		found = v != nil
+		if err := tx.Delete("feeds", url); err != nil {
+			return err
+		}
+		keys := []string{}
+		err = tx.Iterate("feedseen", seen_key(url, ""), func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete("feedseen", k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+func seen_key(url, guid string) string {
+	return url + " " + guid
+}
+
+// feed_seen reports whether entry guid of feed url was seen
+func feed_seen(url, guid string) (bool, error) {
+	seen := false
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("feedseen", seen_key(url, guid))
+		seen = v != nil
+		return err
+	})
+	return seen, err
+}
+
+// mark_seen records entry guid of feed url with the id of the doc ingested from it, if any
+func mark_seen(url, guid, id string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put("feedseen", seen_key(url, guid), []byte(id))
+	})
+}
+
+// entry_doc builds doc of a feed entry, full content in the feed is used as is,
+// otherwise the linked page is extracted, falling back to the summary of the entry
+func entry_doc(sub *Subscription, entry *extractor.FeedEntry) (*Doc, error) {
+	doc := &Doc{Src: entry.Link, Title: entry.Title, Author: entry.Author, Feed: sub.Url, Published: unix_time(entry.Published)}
+	if entry.Content != "" {
+		doc.Content = extractor.HTMLText(entry.Content)
+	} else if entry.Link != "" {
+		page, err := extractor.ParseContent(entry.Link)
+		if err == nil {
+			if page.Title != "" {
+				doc.Title = page.Title
+			}
+			if author := strings.TrimSpace(page.Author); author != "" {
+				doc.Author = author
+			}
+			if doc.Published == 0 {
+				doc.Published = unix_time(page.Published)
+			}
+			doc.Content = page.Description
+			doc.Headings = page.Headings
+			doc.Images = page_images(page)
+		} else if entry.Summary == "" {
+			return nil, err
+		} else {
+			logrus.Errorf("%v: %v, using summary", entry.Link, err)
+		}
+	}
+	if doc.Content == "" {
+		doc.Content = extractor.HTMLText(entry.Summary)
+	}
+	if doc.Src == "" {
+		doc.Src = sub.Url
+	}
+
+	id, err := new_doc_id()
+	if err != nil {
+		return nil, err
+	}
+	doc.Id = id
+	doc.ReadingTime = reading_time(doc.Content)
+	doc.Language = detect_language(doc.Title + "\n" + doc.Content)
+	doc.Keywords = doc_keywords(doc)
+	return doc, nil
+}
+
+// poll_feed fetches sub and indexes entries not seen before, or only marks them seen when ingest is false,
+// entries failing to be extracted are left unseen so that the next poll retries them
+func poll_feed(sub *Subscription, ingest bool) (int, error) {
+	sub.CheckedAt = time.Now().Unix()
+	res, err := extractor.FetchFeed(sub.Url, sub.ETag, sub.LastModified)
+	if err != nil {
+		sub.Error = err.Error()
+		if perr := put_feed(sub); perr != nil {
+			logrus.Error(perr)
+		}
+		return 0, err
+	}
+	sub.Error = ""
+	sub.ETag, sub.LastModified = res.ETag, res.LastModified
+	if res.NotModified {
+		return 0, put_feed(sub)
+	}
+	if sub.Title == "" {
+		sub.Title = res.Feed.Title
+	}
+
+	count := 0
+	for i := range res.Feed.Entries {
+		entry := &res.Feed.Entries[i]
+		if entry.GUID == "" {
+			continue
+		}
+		seen, err := feed_seen(sub.Url, entry.GUID)
+		if err != nil {
+			return count, err
+		}
+		if seen {
+			continue
+		}
+		if !ingest {
+			if err := mark_seen(sub.Url, entry.GUID, ""); err != nil {
+				return count, err
+			}
+			continue
+		}
+
+		doc, err := entry_doc(sub, entry)
+		if err != nil {
+			logrus.Errorf("%v: %v", entry.Link, err)
+			continue
+		}
+		if err := save_doc(doc); err != nil {
+			return count, err
+		}
+		if err := mark_seen(sub.Url, entry.GUID, doc.Id); err != nil {
+			return count, err
+		}
+		logrus.Infof("indexed %v", doc.Title)
+		alert_saved(doc)
+		count++
+	}
+	return count, put_feed(sub)
+}
+
+type opml struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Outline []opmloutline `xml:"body>outline"`
+}
+
+type opmloutline struct {
+	Text    string        `xml:"text,attr"`
+	Title   string        `xml:"title,attr,omitempty"`
+	Type    string        `xml:"type,attr,omitempty"`
+	XMLUrl  string        `xml:"xmlUrl,attr,omitempty"`
+	Outline []opmloutline `xml:"outline"`
+}
+
+// export_opml renders subscriptions as opml
+func export_opml(subs []*Subscription) ([]byte, error) {
+	doc := opml{Version: "2.0", Title: "ReadEngine subscriptions"}
+	for _, sub := range subs {
+		doc.Outline = append(doc.Outline, opmloutline{Text: feed_name(sub), Title: sub.Title, Type: "rss", XMLUrl: sub.Url})
+	}
+	bs, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(bs, '\n')...), nil
+}
+
+// parse_opml returns feeds of opml, outlines nested in categories included
+func parse_opml(data []byte) ([]*Subscription, error) {
+	doc := opml{}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	subs := []*Subscription{}
+	var walk func(outlines []opmloutline)
+	walk = func(outlines []opmloutline) {
+		for _, o := range outlines {
+			if o.XMLUrl != "" {
+				title := o.Title
+				if title == "" {
+					title = o.Text
+				}
+				subs = append(subs, &Subscription{Url: strings.TrimSpace(o.XMLUrl), Title: strings.TrimSpace(title)})
+			}
+			walk(o.Outline)
+		}
+	}
+	walk(doc.Outline)
+	return subs, nil
+}
+
+func feed_add(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "add")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	for _, url := range c.Args() {
+		sub, err := get_feed(url)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if sub != nil {
+			logrus.Infof("already subscribed to %v", url)
+			continue
+		}
+		sub = &Subscription{Url: url, Title: c.String("title"), AddedAt: time.Now().Unix()}
+		count, err := poll_feed(sub, !c.Bool("skip-existing"))
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("subscribed to %v, %v entries indexed", feed_name(sub), count)
+	}
+	return nil
+}
+
+func feed_list(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	subs, err := list_feeds()
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, sub := range subs {
+		checked := "-"
+		if sub.CheckedAt > 0 {
+			checked = time.Unix(sub.CheckedAt, 0).Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", sub.Url, sub.Title, checked, sub.Error)
+	}
+	w.Flush()
+	return nil
+}
+
+func feed_remove(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "remove")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	for _, url := range c.Args() {
+		found, err := del_feed(url)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if found {
+			logrus.Infof("unsubscribed from %v", url)
+		} else {
+			logrus.Errorf("feed %v not found", url)
+		}
+	}
+	return nil
+}
+
+func feed_export(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	subs, err := list_feeds()
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	bs, err := export_opml(subs)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if output := c.String("output"); output != "" {
+		if err := ioutil.WriteFile(output, bs, 0644); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("exported %v feeds to %v", len(subs), output)
+	} else {
+		fmt.Print(string(bs))
+	}
+	return nil
+}
+
+// feed_import subscribes to feeds of an opml file, their entries are indexed by the next poll
+// unless skip-existing marks them seen now
+func feed_import(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "import")
+	}
+	data, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	imported, err := parse_opml(data)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	init_engine(c)
+	defer close_engine()
+
+	count := 0
+	for _, sub := range imported {
+		existing, err := get_feed(sub.Url)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		sub.AddedAt = time.Now().Unix()
+		if c.Bool("skip-existing") {
+			if _, err := poll_feed(sub, false); err != nil {
+				logrus.Errorf("%v: %v", sub.Url, err)
+			}
+		} else if err := put_feed(sub); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		count++
+	}
+	logrus.Infof("imported %v of %v feeds", count, len(imported))
+	return nil
+}
+
+func feed_poll(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	interval := c.Duration("interval")
+	for {
+		subs := []*Subscription{}
+		if c.NArg() == 0 {
+			var err error
+			subs, err = list_feeds()
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+		}
+		for _, url := range c.Args() {
+			sub, err := get_feed(url)
+			if err != nil {
+				logrus.Error(err)
+				return err
+			}
+			if sub == nil {
+				logrus.Errorf("feed %v not found", url)
+				continue
+			}
+			subs = append(subs, sub)
+		}
+
+		poll_feeds(subs, nil)
+
+		if interval <= 0 {
+			break
+		}
+		logrus.Infof("next poll at %v", time.Now().Add(interval).Format(time.RFC3339))
+		time.Sleep(interval)
+	}
+	return nil
+}
+
+// poll_feeds polls subs and indexes their new entries, until stop is closed
+func poll_feeds(subs []*Subscription, stop <-chan struct{}) {
+	total, polled := 0, 0
+	for _, sub := range subs {
+		select {
+		case <-stop:
+			logrus.Info("polling stopped")
+			return
+		default:
+		}
+		polled++
+		count, err := poll_feed(sub, true)
+		if err != nil {
+			logrus.Errorf("%v: %v", sub.Url, err)
+			continue
+		}
+		if count > 0 {
+			logrus.Infof("%v: %v new entries", feed_name(sub), count)
+		}
+		total += count
+	}
+	logrus.Infof("polled %v feeds, %v entries indexed", polled, total)
+}
+
+func feed_name(sub *Subscription) string {
+	if sub.Title != "" {
+		return sub.Title
+	}
+	return sub.Url
+}
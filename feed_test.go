@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+const testrss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+<title>Go Blog</title>
+<link>https://blog.golang.org/</link>
+<item>
+<title>Go pipelines</title>
+<link>/pipelines</link>
+<guid>pipelines</guid>
+<dc:creator>Sameer Ajmani</dc:creator>
+<description>A short summary</description>
+<content:encoded><![CDATA[<p>Each stage is a goroutine.</p><p>Stages are connected by channels.</p>]]></content:encoded>
+<pubDate>Thu, 13 Mar 2014 00:00:00 +0000</pubDate>
+</item>
+<item>
+<title>Go scheduler</title>
+<link>/scheduler</link>
+<description>The scheduler multiplexes goroutines onto threads.</description>
+</item>
+</channel>
+</rss>`
+
+const testatom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Bread</title>
+<link href="https://bread.example.com/"/>
+<entry>
+<title>Sourdough</title>
+<link rel="alternate" href="https://bread.example.com/sourdough"/>
+<id>urn:sourdough</id>
+<author><name>Baker</name></author>
+<updated>2018-01-02T10:00:00Z</updated>
+<content type="html">&lt;p&gt;Feed the starter every day.&lt;/p&gt;</content>
+</entry>
+</feed>`
+
+const testjsonfeed = `{
+"version": "https://jsonfeed.org/version/1",
+"title": "Notes",
+"items": [{"id": 1, "url": "https://notes.example.com/1", "title": "First", "content_text": "plain text note"}]
+}`
+
+func TestParseFeed(t *testing.T) {
+	rss, err := extractor.ParseFeed([]byte(testrss), "https://blog.golang.org/feed.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss.Title != "Go Blog" || len(rss.Entries) != 2 {
+		t.Fatalf("unexpected rss %+v", rss)
+	}
+	first, second := rss.Entries[0], rss.Entries[1]
+	if first.Link != "https://blog.golang.org/pipelines" || first.Author != "Sameer Ajmani" || first.Published.Year() != 2014 {
+		t.Errorf("unexpected rss entry %+v", first)
+	}
+	if extractor.HTMLText(first.Content) != "Each stage is a goroutine.\nStages are connected by channels." {
+		t.Errorf("unexpected content %q", extractor.HTMLText(first.Content))
+	}
+	if second.GUID != second.Link || second.Content != "" {
+		t.Errorf("guid should fall back to link, got %+v", second)
+	}
+
+	atom, err := extractor.ParseFeed([]byte(testatom), "https://bread.example.com/atom.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != 1 || atom.Entries[0].GUID != "urn:sourdough" || atom.Entries[0].Author != "Baker" ||
+		atom.Entries[0].Link != "https://bread.example.com/sourdough" || atom.Entries[0].Published.IsZero() {
+		t.Errorf("unexpected atom %+v", atom)
+	}
+
+	jf, err := extractor.ParseFeed([]byte(testjsonfeed), "https://notes.example.com/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jf.Entries) != 1 || jf.Entries[0].GUID != "1" || jf.Entries[0].Content != "plain text note" {
+		t.Errorf("unexpected json feed %+v", jf)
+	}
+
+	if _, err := extractor.ParseFeed([]byte("<html></html>"), ""); err != extractor.ErrUnknownFeed {
+		t.Errorf("expect unknown feed, got %v", err)
+	}
+}
+
+func TestPollFeed(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	fetches, conditional := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			fetches++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(testrss))
+		case "/scheduler":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>Go scheduler</title></head><body><article><h1>Go scheduler</h1>` +
+				`<p>The scheduler multiplexes goroutines onto threads of the operating system, each processor keeps a run queue of goroutines.</p>` +
+				`<p>When a goroutine blocks in a system call the thread is handed off so that other goroutines keep running.</p></article></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sub := &Subscription{Url: server.URL + "/feed"}
+	count, err := poll_feed(sub, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || sub.Title != "Go Blog" || sub.ETag != `"v1"` {
+		t.Fatalf("unexpected poll result %v %+v", count, sub)
+	}
+
+	res, err := run_search(&searchoptions{Keyword: "feed:" + sub.Url + " goroutine", Mode: ModeMatch, Boost: conf.Boost, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 {
+		t.Errorf("expect both entries indexed with feed, got %v", res.Total)
+	}
+
+	//not modified
+	if count, err := poll_feed(sub, true); err != nil || count != 0 || conditional != 1 {
+		t.Errorf("expect conditional request, got %v %v %v", count, err, conditional)
+	}
+
+	//seen entries are not indexed again
+	sub.ETag = ""
+	if count, err := poll_feed(sub, true); err != nil || count != 0 {
+		t.Errorf("expect no new entries, got %v %v", count, err)
+	}
+	if ids, _ := doc_ids(); len(ids) != 2 {
+		t.Errorf("expect 2 docs, got %v", ids)
+	}
+
+	found, err := del_feed(sub.Url)
+	if err != nil || !found {
+		t.Fatal(found, err)
+	}
+	if seen, _ := feed_seen(sub.Url, "pipelines"); seen {
+		t.Error("seen entries should be removed with subscription")
+	}
+	if fetches != 3 || !strings.HasPrefix(sub.Url, server.URL) {
+		t.Errorf("unexpected fetches %v", fetches)
+	}
+}
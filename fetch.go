@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+// Fetch limits requests of pages and feeds to each host
+type Fetch struct {
+	//honor robots.txt and its Crawl-delay
+	Robots bool `yaml:"robots"`
+	//name matched against User-agent of robots.txt
+	Agent string `yaml:"agent"`
+	//requests in flight to a host, 0 for no limit
+	HostConcurrency int `yaml:"host_concurrency"`
+	//requests per second to a host, 0 for no limit
+	HostRPS float64 `yaml:"host_rps"`
+	//longest Retry-After of 429 and 503 waited for before retrying
+	MaxRetryAfter time.Duration `yaml:"max_retry_after"`
+}
+
+func default_fetch() Fetch {
+	return Fetch{
+		Agent:           "readengine",
+		HostConcurrency: 2,
+		MaxRetryAfter:   30 * time.Second,
+	}
+}
+
+// set_politeness applies settings to the fetcher
+func set_politeness(settings Fetch) {
+	extractor.SetPoliteness(extractor.Politeness{
+		Robots:          settings.Robots,
+		Agent:           settings.Agent,
+		HostConcurrency: settings.HostConcurrency,
+		HostRPS:         settings.HostRPS,
+		MaxRetryAfter:   settings.MaxRetryAfter,
+	})
+}
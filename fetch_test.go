@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+func TestPoliteness(t *testing.T) {
+	var hits, limited int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /\n\nUser-agent: readengine\nDisallow: /private\nAllow: /private/ok$\nCrawl-delay: 0.05\n"))
+		case "/busy":
+			//answers 429 once then serves the page
+			if atomic.AddInt32(&limited, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("ok"))
+		default:
+			atomic.AddInt32(&hits, 1)
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+	defer set_politeness(Fetch{})
+
+	set_politeness(Fetch{Robots: true, Agent: "readengine", HostConcurrency: 1, MaxRetryAfter: 2 * time.Second})
+	for path, allowed := range map[string]bool{"/": true, "/private/a": false, "/private/ok": true, "/private/ok/no": false} {
+		_, err := extractor.Check(server.URL+path, "", "")
+		if allowed && err != nil || !allowed && err != extractor.ErrDisallowed {
+			t.Errorf("%v: expect allowed %v, got %v", path, allowed, err)
+		}
+	}
+
+	//crawl delay spaces requests to the host
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := extractor.Check(server.URL+"/page", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expect requests spaced by crawl delay, took %v", elapsed)
+	}
+
+	start = time.Now()
+	result, err := extractor.Check(server.URL+"/busy", "", "")
+	if err != nil || result.StatusCode != http.StatusOK {
+		t.Fatalf("expect retried after Retry-After, got %+v %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expect wait for Retry-After, took %v", elapsed)
+	}
+
+	//longer Retry-After than allowed is returned as it is
+	atomic.StoreInt32(&limited, 0)
+	set_politeness(Fetch{MaxRetryAfter: 500 * time.Millisecond})
+	if result, err := extractor.Check(server.URL+"/busy", "", ""); err != nil || result.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expect 429 returned, got %+v %v", result, err)
+	}
+	if _, err := extractor.Check(server.URL+"/private/a", "", ""); err != nil {
+		t.Errorf("expect robots ignored, got %v", err)
+	}
+}
+
+func TestRobotsUnavailable(t *testing.T) {
+	var hits int32
+	moved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer moved.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.Redirect(w, r, moved.URL+"/robots.txt", http.StatusMovedPermanently)
+		default:
+			atomic.AddInt32(&hits, 1)
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("ok"))
+	}))
+	defer failing.Close()
+	defer set_politeness(Fetch{})
+	set_politeness(Fetch{Robots: true, Agent: "readengine"})
+
+	//robots.txt is followed through redirects even by checks, which do not follow them
+	if _, err := extractor.Check(server.URL+"/private/a", "", ""); err != extractor.ErrDisallowed {
+		t.Errorf("expect disallowed by moved robots.txt, got %v", err)
+	}
+	if result, err := extractor.Check(server.URL+"/a", "", ""); err != nil || result.StatusCode != http.StatusOK {
+		t.Errorf("expect allowed, got %+v %v", result, err)
+	}
+
+	//a robots.txt failing with a server error disallows everything
+	for i := 0; i < 2; i++ {
+		if _, err := extractor.Check(failing.URL+"/a", "", ""); err != extractor.ErrRobotsUnavailable {
+			t.Errorf("expect robots.txt unavailable, got %v", err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("expect 1 page requested, got %v", hits)
+	}
+}
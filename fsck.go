@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// kinds of problems fsck finds
+const (
+	//record of db fails to decode
+	ProblemUndecodable = "undecodable"
+	//doc of db is missing from index
+	ProblemUnindexed = "unindexed"
+	//index entry or highlight whose doc is missing from db
+	ProblemOrphaned = "orphaned"
+)
+
+// problem is an inconsistency of record key in bucket, bucket is "index" for entries of the index
+type problem struct {
+	Kind   string
+	Bucket string
+	Key    string
+	Detail string
+}
+
+func (p problem) String() string {
+	s := fmt.Sprintf("%v %v %v", p.Kind, p.Bucket, p.Key)
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return s
+}
+
+// index_ids lists ids of all docs in index
+func index_ids() (map[string]bool, error) {
+	i, _, err := idx.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := i.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	all, err := reader.DocIDReaderAll()
+	if err != nil {
+		return nil, err
+	}
+	defer all.Close()
+
+	ids := map[string]bool{}
+	for {
+		internal, err := all.Next()
+		if err != nil {
+			return nil, err
+		}
+		if internal == nil {
+			return ids, nil
+		}
+		id, err := reader.ExternalID(internal)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+}
+
+// fsck_check compares docs and highlights of db with the index
+func fsck_check() ([]problem, error) {
+	problems := []problem{}
+	stored := map[string]bool{}
+	decoded := []string{}
+	err := db.View(func(tx *Tx) error {
+		err := tx.Iterate("readengine", "", func(k string, v []byte) error {
+			stored[k] = true
+			doc := Doc{}
+			if err := json.Unmarshal(v, &doc); err != nil {
+				problems = append(problems, problem{Kind: ProblemUndecodable, Bucket: "readengine", Key: k, Detail: err.Error()})
+				return nil
+			}
+			decoded = append(decoded, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Iterate("highlights", "", func(k string, v []byte) error {
+			h := Highlight{}
+			if err := json.Unmarshal(v, &h); err != nil {
+				problems = append(problems, problem{Kind: ProblemUndecodable, Bucket: "highlights", Key: k, Detail: err.Error()})
+				return nil
+			}
+			if !stored[h.DocId] {
+				problems = append(problems, problem{Kind: ProblemOrphaned, Bucket: "highlights", Key: k, Detail: "doc " + h.DocId + " not found"})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := index_ids()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range decoded {
+		if !indexed[id] {
+			problems = append(problems, problem{Kind: ProblemUnindexed, Bucket: "readengine", Key: id})
+		}
+	}
+	orphans := []string{}
+	for id := range indexed {
+		if !stored[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	for _, id := range orphans {
+		problems = append(problems, problem{Kind: ProblemOrphaned, Bucket: "index", Key: id})
+	}
+	return problems, nil
+}
+
+// fsck_repair fixes problems, undecodable records are moved to the corrupt bucket keyed by their bucket and key,
+// and removed from index with docs missing from db, while docs missing from index are indexed again
+func fsck_repair(problems []problem) error {
+	err := db.Update(func(tx *Tx) error {
+		for _, p := range problems {
+			switch {
+			case p.Kind == ProblemUndecodable:
+				v, err := tx.Get(p.Bucket, p.Key)
+				if err != nil {
+					return err
+				}
+				if v == nil {
+					continue
+				}
+				if err := tx.Put("corrupt", p.Bucket+" "+p.Key, append([]byte{}, v...)); err != nil {
+					return err
+				}
+				if err := tx.Delete(p.Bucket, p.Key); err != nil {
+					return err
+				}
+			case p.Kind == ProblemOrphaned && p.Bucket == "highlights":
+				if err := tx.Delete(p.Bucket, p.Key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range problems {
+		switch {
+		case p.Kind == ProblemUndecodable && p.Bucket == "readengine", p.Kind == ProblemOrphaned && p.Bucket == "index":
+			err = idx.Delete(p.Key)
+		case p.Kind == ProblemUnindexed:
+			var doc *Doc
+			if doc, err = get_doc(p.Key); err == nil && doc != nil {
+				err = index_doc(doc)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fsck(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	problems, err := fsck_check()
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	counts := map[string]int{}
+	for _, p := range problems {
+		counts[p.Kind]++
+		logrus.Warn(p)
+	}
+	logrus.Infof("found %v problems: %v", len(problems), counts)
+	if len(problems) == 0 || !c.Bool("repair") {
+		return nil
+	}
+
+	if err := fsck_repair(problems); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("repaired %v problems", len(problems))
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDeleteDoc(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	doc := &Doc{Id: "1514764800", Src: "https://a.com", Title: "Go pipelines", Content: "Goroutines connected by channels."}
+	if err := save_doc(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := put_highlight(&Highlight{Id: "1514764800-1", DocId: doc.Id, Exact: "channels"}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := delete_doc(doc.Id)
+	if err != nil || !found {
+		t.Fatalf("expect doc deleted, got %v %v", found, err)
+	}
+	if d, err := get_doc(doc.Id); err != nil || d != nil {
+		t.Errorf("expect doc removed from db, got %v %v", d, err)
+	}
+	if d, err := idx.Document(doc.Id); err != nil || d != nil {
+		t.Errorf("expect doc removed from index, got %v %v", d, err)
+	}
+	if hs, err := list_highlights(doc.Id); err != nil || len(hs) != 0 {
+		t.Errorf("expect highlights removed, got %v %v", hs, err)
+	}
+	if id, err := src_doc_id(doc.Src); err != nil || id != "" {
+		t.Errorf("expect src removed, got %v %v", id, err)
+	}
+
+	if found, err := delete_doc(doc.Id); err != nil || found {
+		t.Errorf("expect nothing to delete, got %v %v", found, err)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	if err := save_doc(&Doc{Id: "1514764800", Src: "https://a.com", Title: "Go pipelines"}); err != nil {
+		t.Fatal(err)
+	}
+	//saved but never indexed
+	if err := put_doc(&Doc{Id: "1517443200", Src: "https://b.com", Title: "Worker pools"}); err != nil {
+		t.Fatal(err)
+	}
+	//indexed but never saved
+	if err := index_doc(&Doc{Id: "1519862400", Src: "https://c.com", Title: "Go modules"}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Update(func(tx *Tx) error {
+		if err := tx.Put("readengine", "1522540800", []byte(`{"Id":`)); err != nil {
+			return err
+		}
+		return tx.Put("highlights", "1525132800-1", []byte(`{"Id":"1525132800-1","DocId":"1525132800"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := fsck_check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]bool{
+		"undecodable readengine 1522540800": true,
+		"unindexed readengine 1517443200":   true,
+		"orphaned index 1519862400":         true,
+		"orphaned highlights 1525132800-1":  true,
+	}
+	if len(problems) != len(expect) {
+		t.Errorf("expect %v problems, got %v", len(expect), problems)
+	}
+	for _, p := range problems {
+		if !expect[p.Kind+" "+p.Bucket+" "+p.Key] {
+			t.Errorf("unexpected problem %v", p)
+		}
+	}
+
+	if err := fsck_repair(problems); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := fsck_check(); err != nil || len(problems) != 0 {
+		t.Errorf("expect no problems after repair, got %v %v", problems, err)
+	}
+	db.View(func(tx *Tx) error {
+		if v, err := tx.Get("corrupt", "readengine 1522540800"); err != nil || string(v) != `{"Id":` {
+			t.Errorf("expect undecodable doc kept aside, got %s %v", v, err)
+		}
+		return nil
+	})
+	if d, err := idx.Document("1517443200"); err != nil || d == nil {
+		t.Errorf("expect unindexed doc indexed, got %v %v", d, err)
+	}
+}
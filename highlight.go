@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sillydong/goczd/gotime"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Highlight is a passage marked in a doc, located by a text quote selector
+type Highlight struct {
+	Id        string
+	DocId     string
+	Exact     string
+	Prefix    string
+	Suffix    string
+	Note      string
+	CreatedAt int64
+}
+
+// length of prefix and suffix taken around the quote when not given
+const selectorcontext = 32
+
+var ErrQuoteNotFound = errors.New("quote not found in doc")
+
+// new_highlight locates exact in the content of doc and fills prefix and suffix from content when empty
+func new_highlight(doc *Doc, exact, prefix, suffix, note string) (*Highlight, error) {
+	exact = strings.TrimSpace(exact)
+	if exact == "" {
+		return nil, ErrQuoteNotFound
+	}
+	pos := locate_quote(doc.Content, exact, prefix, suffix)
+	if pos < 0 {
+		return nil, ErrQuoteNotFound
+	}
+	if prefix == "" {
+		prefix = tail_runes(doc.Content[:pos], selectorcontext)
+	}
+	if suffix == "" {
+		suffix = head_runes(doc.Content[pos+len(exact):], selectorcontext)
+	}
+
+	now := time.Now()
+	return &Highlight{
+		Id:        doc.Id + "-" + strconv.FormatInt(now.UnixNano(), 10),
+		DocId:     doc.Id,
+		Exact:     exact,
+		Prefix:    prefix,
+		Suffix:    suffix,
+		Note:      strings.TrimSpace(note),
+		CreatedAt: now.Unix(),
+	}, nil
+}
+
+// locate_quote returns the byte offset of exact in content, using prefix and suffix
+// to pick the right occurrence, -1 if not found
+func locate_quote(content, exact, prefix, suffix string) int {
+	first := -1
+	for offset := 0; offset <= len(content); {
+		pos := strings.Index(content[offset:], exact)
+		if pos < 0 {
+			break
+		}
+		pos += offset
+		if first < 0 {
+			first = pos
+		}
+		if strings.HasSuffix(content[:pos], prefix) && strings.HasPrefix(content[pos+len(exact):], suffix) {
+			return pos
+		}
+		offset = pos + len(exact)
+	}
+	return first
+}
+
+func tail_runes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		runes = runes[len(runes)-n:]
+	}
+	return string(runes)
+}
+
+func head_runes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	return string(runes)
+}
+
+func put_highlight(h *Highlight) error {
+	return db.Update(func(tx *Tx) error {
+		bs, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		return tx.Put("highlights", h.Id, bs)
+	})
+}
+
+// del_highlight removes highlight by id and returns it, nil if not found
+func del_highlight(id string) (*Highlight, error) {
+	var h *Highlight
+	err := db.Update(func(tx *Tx) error {
+		v, err := tx.Get("highlights", id)
+		if err != nil || v == nil {
+			return err
+		}
+		h = &Highlight{}
+		if err := json.Unmarshal(v, h); err != nil {
+			return err
+		}
+		return tx.Delete("highlights", id)
+	})
+	return h, err
+}
+
+// list_highlights returns highlights of doc, or all highlights when docid is empty
+func list_highlights(docid string) ([]*Highlight, error) {
+	highlights := []*Highlight{}
+	prefix := ""
+	if docid != "" {
+		prefix = docid + "-"
+	}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("highlights", prefix, func(k string, v []byte) error {
+			h := &Highlight{}
+			if err := json.Unmarshal(v, h); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			highlights = append(highlights, h)
+			return nil
+		})
+	})
+	return highlights, err
+}
+
+// add_highlight saves highlight for doc and saves the doc again, which stamps its modified time
+// for incremental rebuilds and reindexes it
+func add_highlight(doc *Doc, exact, prefix, suffix, note string) (*Highlight, error) {
+	h, err := new_highlight(doc, exact, prefix, suffix, note)
+	if err != nil {
+		return nil, err
+	}
+	if err := put_highlight(h); err != nil {
+		return nil, err
+	}
+	return h, save_doc(doc)
+}
+
+// remove_highlight deletes highlight and saves its doc again like add_highlight
+func remove_highlight(id string) (*Highlight, error) {
+	h, err := del_highlight(id)
+	if err != nil || h == nil {
+		return h, err
+	}
+	doc, err := get_doc(h.DocId)
+	if err != nil || doc == nil {
+		return h, err
+	}
+	return h, save_doc(doc)
+}
+
+func highlight_add(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "add")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	doc, err := get_doc(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if doc == nil {
+		logrus.Error("未找到数据")
+		return nil
+	}
+
+	h, err := add_highlight(doc, strings.Join(c.Args().Tail(), " "), c.String("prefix"), c.String("suffix"), c.String("note"))
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("highlight %v added", h.Id)
+	return nil
+}
+
+func highlight_list(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	highlights, err := list_highlights(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	for _, h := range highlights {
+		fmt.Printf("[%v][%v] %v\n", h.Id, gotime.TimeToStr(h.CreatedAt, gotime.FORMAT_YYYY_MM_DD_HH_II_SS), h.Exact)
+		if h.Note != "" {
+			fmt.Printf("\tnote: %v\n", h.Note)
+		}
+	}
+	return nil
+}
+
+func highlight_del(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "del")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	for _, id := range c.Args() {
+		h, err := remove_highlight(id)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if h == nil {
+			logrus.Errorf("highlight %v not found", id)
+		} else {
+			logrus.Infof("highlight %v deleted", id)
+		}
+	}
+	return nil
+}
+
+func highlight_export(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	highlights, err := list_highlights("")
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	markdown, err := highlights_markdown(highlights)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if output := c.String("output"); output != "" {
+		if err := ioutil.WriteFile(output, markdown, 0644); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("exported %v highlights to %v", len(highlights), output)
+	} else {
+		fmt.Print(string(markdown))
+	}
+	return nil
+}
+
+// highlights_markdown renders highlights grouped by doc, highlights must be ordered by doc
+func highlights_markdown(highlights []*Highlight) ([]byte, error) {
+	buf := bytes.NewBufferString("# Highlights\n")
+	docid := ""
+	for _, h := range highlights {
+		if h.DocId != docid {
+			docid = h.DocId
+			doc, err := get_doc(docid)
+			if err != nil {
+				return nil, err
+			}
+			if doc != nil {
+				fmt.Fprintf(buf, "\n## [%v](%v)\n", markdown_escape(doc.Title), doc.Src)
+			} else {
+				fmt.Fprintf(buf, "\n## %v\n", docid)
+			}
+		}
+		fmt.Fprintf(buf, "\n> %v\n", strings.Replace(h.Exact, "\n", "\n> ", -1))
+		if h.Note != "" {
+			fmt.Fprintf(buf, "\n%v\n", h.Note)
+		}
+		fmt.Fprintf(buf, "\n*%v*\n", gotime.TimeToStr(h.CreatedAt, gotime.FORMAT_YYYY_MM_DD_HH_II_SS))
+	}
+	return buf.Bytes(), nil
+}
+
+func markdown_escape(s string) string {
+	return strings.NewReplacer("[", "\\[", "]", "\\]").Replace(s)
+}
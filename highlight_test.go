@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestNewHighlight(t *testing.T) {
+	doc := &Doc{Id: "1", Content: "go go 并发 go gopher"}
+
+	h, err := new_highlight(doc, "go", "并发 ", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Prefix != "并发 " || h.Suffix != " gopher" {
+		t.Errorf("unexpected selector %q %q", h.Prefix, h.Suffix)
+	}
+
+	h, err = new_highlight(doc, "并发", "", "", "note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Prefix != "go go " || h.Suffix != " go gopher" || h.Note != "note" {
+		t.Errorf("unexpected highlight %+v", h)
+	}
+
+	if _, err := new_highlight(doc, "rust", "", "", ""); err != ErrQuoteNotFound {
+		t.Errorf("expect ErrQuoteNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// states of jobs
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is an url queued to be indexed, kept in the jobs bucket keyed by Id which sorts by creation
+type Job struct {
+	Id        string
+	Url       string
+	Status    string
+	Attempts  int
+	Error     string
+	DocId     string
+	CreatedAt int64
+	UpdatedAt int64
+	//a failed attempt is retried after NextAt
+	NextAt int64
+}
+
+// Daemon configures the workers processing jobs, Addr is where the daemon serves the api
+// so that commands can queue jobs while it holds the db
+type Daemon struct {
+	Addr        string `yaml:"addr"`
+	Concurrency int    `yaml:"concurrency"`
+	MaxAttempts int    `yaml:"max_attempts"`
+	//wait before the first retry, doubled for each later one
+	Backoff time.Duration `yaml:"backoff"`
+	//link checks of all docs and polls of all feeds run every interval, 0 turns them off
+	CheckInterval time.Duration `yaml:"check_interval"`
+	PollInterval  time.Duration `yaml:"poll_interval"`
+}
+
+func default_daemon() Daemon {
+	return Daemon{
+		Addr:          "127.0.0.1:8080",
+		Concurrency:   2,
+		MaxAttempts:   5,
+		Backoff:       time.Minute,
+		CheckInterval: 24 * time.Hour,
+		PollInterval:  time.Hour,
+	}
+}
+
+// how long idle workers wait before looking for jobs again
+const jobpoll = time.Second
+
+var daemonclient = &http.Client{Timeout: 5 * time.Second}
+
+// daemon_down reports whether err of a request to the daemon means that it is not running,
+// other errors such as timeouts of a busy daemon are not, as the daemon still holds the db
+func daemon_down(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// queue_job adds url to the queue as pending job
+func queue_job(url string) (*Job, error) {
+	now := time.Now().Unix()
+	job := &Job{Url: url, Status: JobPending, CreatedAt: now, UpdatedAt: now}
+	err := db.Update(func(tx *Tx) error {
+		seq, err := tx.NextSequence("jobs")
+		if err != nil {
+			return err
+		}
+		job.Id = fmt.Sprintf("%010d", seq)
+		return put_job(tx, job)
+	})
+	return job, err
+}
+
+// queue_new_jobs queues urls that are neither docs in the store nor waiting in the queue
+func queue_new_jobs(urls []string) ([]*Job, error) {
+	queued := map[string]bool{}
+	for _, status := range []string{JobPending, JobRunning} {
+		jobs, err := list_jobs(status)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			queued[job.Url] = true
+		}
+	}
+	jobs := []*Job{}
+	for _, u := range urls {
+		if queued[u] {
+			continue
+		}
+		if id, err := src_doc_id(u); err != nil {
+			return jobs, err
+		} else if id != "" {
+			continue
+		}
+		queued[u] = true
+		job, err := queue_job(u)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func put_job(tx *Tx, job *Job) error {
+	bs, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Put("jobs", job.Id, bs)
+}
+
+// list_jobs lists jobs with status or all jobs if status is empty, oldest first
+func list_jobs(status string) ([]*Job, error) {
+	jobs := []*Job{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("jobs", "", func(k string, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			if status == "" || job.Status == status {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+// claim_job marks the oldest pending job due at now as running, returns nil if there is none
+func claim_job(now time.Time) (*Job, error) {
+	var claimed *Job
+	err := db.Update(func(tx *Tx) error {
+		err := tx.Iterate("jobs", "", func(k string, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			if job.Status != JobPending || job.NextAt > now.Unix() {
+				return nil
+			}
+			claimed = job
+			return stopiteration
+		})
+		if err != nil || claimed == nil {
+			return err
+		}
+		claimed.Status = JobRunning
+		claimed.Attempts++
+		claimed.UpdatedAt = now.Unix()
+		return put_job(tx, claimed)
+	})
+	return claimed, err
+}
+
+// finish_job records the outcome of an attempt, failed attempts are retried with backoff
+// until max attempts
+func finish_job(job *Job, doc *Doc, failure error, settings Daemon, now time.Time) error {
+	job.UpdatedAt = now.Unix()
+	switch {
+	case failure == nil:
+		job.Status = JobDone
+		job.Error = ""
+		job.DocId = doc.Id
+	case job.Attempts < settings.MaxAttempts && !permanent_failure(failure):
+		job.Status = JobPending
+		job.Error = failure.Error()
+		job.NextAt = now.Add(job_backoff(job.Attempts, settings.Backoff)).Unix()
+	default:
+		job.Status = JobFailed
+		job.Error = failure.Error()
+	}
+	return db.Update(func(tx *Tx) error {
+		return put_job(tx, job)
+	})
+}
+
+// permanent_failure reports whether retrying cannot help, which is when the page is answered
+// with a client error other than timeout or too many requests
+func permanent_failure(err error) bool {
+	if e, ok := err.(*extractor.StatusError); ok {
+		return e.Code >= 400 && e.Code < 500 && e.Code != http.StatusRequestTimeout && e.Code != http.StatusTooManyRequests
+	}
+	return false
+}
+
+// job_backoff is the wait after attempt, doubled for each attempt
+func job_backoff(attempt int, backoff time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 16 {
+		attempt = 16
+	}
+	return backoff << uint(attempt-1)
+}
+
+// requeue_running puts jobs left running by a daemon that stopped back to pending
+func requeue_running() (int, error) {
+	count := 0
+	err := db.Update(func(tx *Tx) error {
+		jobs := []*Job{}
+		err := tx.Iterate("jobs", "", func(k string, v []byte) error {
+			job := &Job{}
+			if err := json.Unmarshal(v, job); err == nil && job.Status == JobRunning {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			job.Status = JobPending
+			if err := put_job(tx, job); err != nil {
+				return err
+			}
+		}
+		count = len(jobs)
+		return nil
+	})
+	return count, err
+}
+
+// run_workers starts workers processing jobs until stop is closed,
+// requests to each host are spaced by the politeness of the extractor
+func run_workers(settings Daemon, stop <-chan struct{}) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < settings.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				//once stopped only running jobs are finished
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				job, err := claim_job(time.Now())
+				if err != nil {
+					logrus.Error(err)
+				}
+				if job == nil {
+					select {
+					case <-stop:
+						return
+					case <-time.After(jobpoll):
+						continue
+					}
+				}
+				run_job(job, settings)
+			}
+		}()
+	}
+	return wg
+}
+
+// schedule is a task the daemon runs every interval
+type schedule struct {
+	name     string
+	interval time.Duration
+	run      func(stop <-chan struct{})
+}
+
+// daemon_schedules are link checks and feed polls at the intervals of settings
+func daemon_schedules(settings Daemon) []schedule {
+	return []schedule{
+		{name: "check", interval: settings.CheckInterval, run: func(stop <-chan struct{}) {
+			ids, err := doc_ids()
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			check_ids(ids, stop)
+		}},
+		{name: "poll", interval: settings.PollInterval, run: func(stop <-chan struct{}) {
+			subs, err := list_feeds()
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			poll_feeds(subs, stop)
+		}},
+	}
+}
+
+// run_schedules runs each schedule every interval until stop is closed, the last run is kept
+// in the meta bucket so that a restarted daemon waits out the rest of the interval
+func run_schedules(schedules []schedule, stop <-chan struct{}) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for _, s := range schedules {
+		if s.interval <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(s schedule) {
+			defer wg.Done()
+			for {
+				last, err := schedule_last_run(s.name)
+				if err != nil {
+					logrus.Error(err)
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Until(last.Add(s.interval))):
+				}
+				logrus.Infof("running scheduled %v", s.name)
+				s.run(stop)
+				if err := set_schedule_last_run(s.name, time.Now()); err != nil {
+					logrus.Error(err)
+				}
+			}
+		}(s)
+	}
+	return wg
+}
+
+func schedule_last_run(name string) (time.Time, error) {
+	last := time.Time{}
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("meta", "schedule "+name)
+		if err != nil || v == nil {
+			return err
+		}
+		sec, err := strconv.ParseInt(string(v), 10, 64)
+		last = time.Unix(sec, 0)
+		return err
+	})
+	return last, err
+}
+
+func set_schedule_last_run(name string, at time.Time) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put("meta", "schedule "+name, []byte(strconv.FormatInt(at.Unix(), 10)))
+	})
+}
+
+func run_job(job *Job, settings Daemon) {
+	logrus.Infof("job %v: indexing %v, attempt %v", job.Id, job.Url, job.Attempts)
+	doc, err := index_page(job.Url)
+	if err != nil {
+		logrus.Errorf("job %v: %v", job.Id, err)
+	} else {
+		logrus.Infof("job %v: indexed %v", job.Id, doc.Title)
+	}
+	if err := finish_job(job, doc, err, settings, time.Now()); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// queue_new_urls is queue_urls skipping urls already in the store or in the queue
+func queue_new_urls(c *cli.Context, urls []string) ([]*Job, error) {
+	load_conf()
+	jobs, err := post_new_jobs(conf.Daemon.Addr, urls)
+	if !daemon_down(err) {
+		return jobs, err
+	}
+
+	init_engine(c)
+	defer close_engine()
+	return queue_new_jobs(urls)
+}
+
+// queue_urls hands urls to a running daemon, which holds the db, or queues them in the db
+// for the daemon to process when it starts
+func queue_urls(c *cli.Context, urls []string) error {
+	load_conf()
+	for len(urls) > 0 {
+		job, err := post_job(conf.Daemon.Addr, urls[0])
+		if daemon_down(err) {
+			break
+		} else if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("queued job %v: %v", job.Id, job.Url)
+		urls = urls[1:]
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	init_engine(c)
+	defer close_engine()
+	for _, u := range urls {
+		job, err := queue_job(u)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("queued job %v: %v, run readengine daemon to process it", job.Id, job.Url)
+	}
+	return nil
+}
+
+// post_job queues url through the api of the daemon at addr
+func post_job(addr, u string) (*Job, error) {
+	bs, err := json.Marshal(map[string]string{"Url": u})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := daemonclient.Post("http://"+addr+"/api/jobs", "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.New(resp.Status)
+	}
+	job := &Job{}
+	return job, json.NewDecoder(resp.Body).Decode(job)
+}
+
+// post_new_jobs queues urls not in the store through the api of the daemon at addr
+func post_new_jobs(addr string, urls []string) ([]*Job, error) {
+	bs, err := json.Marshal(map[string][]string{"Urls": urls})
+	if err != nil {
+		return nil, err
+	}
+	//the daemon looks through the whole store
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Post("http://"+addr+"/api/jobs/new", "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.New(resp.Status)
+	}
+	jobs := []*Job{}
+	return jobs, json.NewDecoder(resp.Body).Decode(&jobs)
+}
+
+// api_new_jobs serves
+//
+//	POST /api/jobs/new with {"Urls": ["..."]}
+//
+// queuing the urls not in the store or in the queue, the new jobs are returned
+func api_new_jobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+	req := struct{ Urls []string }{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		write_error(w, http.StatusBadRequest, "missing urls")
+		return
+	}
+	jobs, err := queue_new_jobs(req.Urls)
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	write_json(w, http.StatusCreated, jobs)
+}
+
+// api_jobs serves
+//
+//	GET  /api/jobs?status=failed
+//	POST /api/jobs with {"Url": "..."}
+func api_jobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := list_jobs(r.URL.Query().Get("status"))
+		if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		req := struct{ Url string }{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Url == "" {
+			write_error(w, http.StatusBadRequest, "missing url")
+			return
+		}
+		job, err := queue_job(req.Url)
+		if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusCreated, job)
+	default:
+		write_error(w, http.StatusNotFound, "not found")
+	}
+}
+
+func daemon(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	settings := conf.Daemon
+	if c.IsSet("addr") {
+		settings.Addr = c.String("addr")
+	}
+	if c.IsSet("concurrency") {
+		settings.Concurrency = c.Int("concurrency")
+	}
+	if settings.Concurrency <= 0 {
+		settings.Concurrency = 1
+	}
+	//jobs space requests to each host even if fetching in general does not
+	fetch := conf.Fetch
+	if c.IsSet("rps") || fetch.HostRPS <= 0 {
+		fetch.HostRPS = c.Float64("rps")
+	}
+	set_politeness(fetch)
+	if count, err := requeue_running(); err != nil {
+		logrus.Error(err)
+		return err
+	} else if count > 0 {
+		logrus.Infof("requeued %v interrupted jobs", count)
+	}
+
+	stop := make(chan struct{})
+	workers := run_workers(settings, stop)
+	schedules := run_schedules(daemon_schedules(settings), stop)
+	server := &http.Server{Addr: settings.Addr, Handler: new_mux()}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		logrus.Info("stopping, waiting for running jobs")
+		server.Close()
+	}()
+
+	logrus.Infof("processing jobs with %v workers, listening on %v", settings.Concurrency, settings.Addr)
+	err := server.ListenAndServe()
+	close(stop)
+	workers.Wait()
+	schedules.Wait()
+	if err != nil && err != http.ErrServerClosed {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+func jobs_list(c *cli.Context) error {
+	load_conf()
+	jobs, err := get_daemon_jobs(conf.Daemon.Addr, c.String("status"))
+	if daemon_down(err) {
+		init_engine(c)
+		defer close_engine()
+		if jobs, err = list_jobs(c.String("status")); err != nil {
+			logrus.Error(err)
+			return err
+		}
+	} else if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, job := range jobs {
+		counts[job.Status]++
+	}
+	states := []string{}
+	for state, count := range counts {
+		states = append(states, fmt.Sprintf("%v %v", count, state))
+	}
+	sort.Strings(states)
+	logrus.Infof("jobs: %v", states)
+
+	if limit := c.Int("limit"); limit > 0 && len(jobs) > limit {
+		jobs = jobs[len(jobs)-limit:]
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", job.Id, job.Status, job.Attempts,
+			time.Unix(job.UpdatedAt, 0).Format("2006-01-02 15:04:05"), job.Url, job_detail(job))
+	}
+	w.Flush()
+	return nil
+}
+
+// job_detail is the doc of a done job or the error of the last attempt
+func job_detail(job *Job) string {
+	switch {
+	case job.Status == JobDone:
+		return "doc " + job.DocId
+	case job.Status == JobPending && job.NextAt > 0:
+		return fmt.Sprintf("retry at %v: %v", time.Unix(job.NextAt, 0).Format("15:04:05"), job.Error)
+	}
+	return job.Error
+}
+
+// get_daemon_jobs lists jobs through the api of the daemon at addr
+func get_daemon_jobs(addr, status string) ([]*Job, error) {
+	resp, err := daemonclient.Get("http://" + addr + "/api/jobs?status=" + url.QueryEscape(status))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	jobs := []*Job{}
+	return jobs, json.NewDecoder(resp.Body).Decode(&jobs)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+func TestJobQueue(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	settings := Daemon{MaxAttempts: 2, Backoff: time.Minute}
+	now := time.Unix(1514764800, 0)
+
+	first, err := queue_job("https://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := queue_job("https://example.com/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Id >= second.Id {
+		t.Errorf("ids should sort by creation, got %v %v", first.Id, second.Id)
+	}
+
+	job, err := claim_job(now)
+	if err != nil || job == nil || job.Id != first.Id || job.Status != JobRunning || job.Attempts != 1 {
+		t.Fatalf("expect first job claimed, got %+v %v", job, err)
+	}
+	if err := finish_job(job, nil, errors.New("timeout"), settings, now); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobPending || job.NextAt != now.Add(time.Minute).Unix() {
+		t.Errorf("expect retry after backoff, got %+v", job)
+	}
+
+	//the first job waits for its backoff
+	if job, _ := claim_job(now); job == nil || job.Id != second.Id {
+		t.Errorf("expect second job claimed, got %+v", job)
+	}
+	if job, _ := claim_job(now); job != nil {
+		t.Errorf("expect no due job, got %+v", job)
+	}
+
+	job, _ = claim_job(now.Add(time.Minute))
+	if job == nil || job.Id != first.Id || job.Attempts != 2 {
+		t.Fatalf("expect first job retried, got %+v", job)
+	}
+	if err := finish_job(job, nil, errors.New("timeout"), settings, now); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobFailed || job.Error != "timeout" {
+		t.Errorf("expect failed after max attempts, got %+v", job)
+	}
+
+	//second job was left running by a daemon that stopped
+	if count, err := requeue_running(); err != nil || count != 1 {
+		t.Errorf("expect 1 job requeued, got %v %v", count, err)
+	}
+	if jobs, _ := list_jobs(JobPending); len(jobs) != 1 || jobs[0].Id != second.Id {
+		t.Errorf("unexpected pending jobs %+v", jobs)
+	}
+
+	//server errors are retried, missing pages are not
+	settings.MaxAttempts = 5
+	job, _ = claim_job(now)
+	if err := finish_job(job, nil, &extractor.StatusError{Code: 503, Status: "503 Service Unavailable"}, settings, now); err != nil || job.Status != JobPending {
+		t.Errorf("expect retry of server error, got %+v %v", job, err)
+	}
+	job, _ = claim_job(now.Add(time.Hour))
+	if err := finish_job(job, nil, &extractor.StatusError{Code: 404, Status: "404 Not Found"}, settings, now); err != nil || job.Status != JobFailed {
+		t.Errorf("expect missing page failed, got %+v %v", job, err)
+	}
+
+	if d := job_backoff(3, time.Minute); d != 4*time.Minute {
+		t.Errorf("unexpected backoff %v", d)
+	}
+}
+
+func TestDaemonDown(t *testing.T) {
+	//nothing listens on a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	addr := closed.Listener.Addr().String()
+	closed.Close()
+	if _, err := post_job(addr, "https://a.com"); !daemon_down(err) {
+		t.Errorf("expect daemon down, got %v", err)
+	}
+
+	//a daemon slow to answer still holds the db
+	release := make(chan struct{})
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer busy.Close()
+	defer close(release)
+	timeout := daemonclient.Timeout
+	daemonclient.Timeout = 50 * time.Millisecond
+	defer func() { daemonclient.Timeout = timeout }()
+	if _, err := post_job(busy.Listener.Addr().String(), "https://a.com"); err == nil || daemon_down(err) {
+		t.Errorf("expect busy daemon not down, got %v", err)
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	//poll ran a minute ago, check never ran
+	if err := set_schedule_last_run("poll", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	runs := make(chan string, 10)
+	run := func(name string) func(stop <-chan struct{}) {
+		return func(stop <-chan struct{}) { runs <- name }
+	}
+	stop := make(chan struct{})
+	wg := run_schedules([]schedule{
+		{name: "check", interval: time.Hour, run: run("check")},
+		{name: "poll", interval: time.Hour, run: run("poll")},
+		{name: "off", run: run("off")},
+	}, stop)
+	select {
+	case name := <-runs:
+		if name != "check" {
+			t.Errorf("expect check to run, got %v", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect check to run")
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	close(runs)
+	for name := range runs {
+		t.Errorf("unexpected run of %v", name)
+	}
+	if last, err := schedule_last_run("check"); err != nil || time.Since(last) > time.Minute {
+		t.Errorf("expect last run of check recorded, got %v %v", last, err)
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scheduler" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Go scheduler</title></head><body><article><h1>Go scheduler</h1>` +
+			`<p>The scheduler multiplexes goroutines onto threads of the operating system, each processor keeps a run queue of goroutines.</p>` +
+			`<p>When a goroutine blocks in a system call the thread is handed off so that other goroutines keep running.</p></article></body></html>`))
+	}))
+	defer pages.Close()
+
+	//jobs are queued through the api like readengine url does while the daemon runs
+	api := httptest.NewServer(new_mux())
+	defer api.Close()
+	for _, path := range []string{"/scheduler", "/missing"} {
+		if _, err := post_job(api.Listener.Addr().String(), pages.URL+path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := http.Post(api.URL+"/api/jobs", "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expect bad request without url, got %v %v", resp, err)
+	}
+
+	stop := make(chan struct{})
+	workers := run_workers(Daemon{Concurrency: 2, MaxAttempts: 2}, stop)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		done, _ := list_jobs(JobDone)
+		failed, _ := list_jobs(JobFailed)
+		if len(done)+len(failed) == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	close(stop)
+	workers.Wait()
+
+	resp, err = http.Get(api.URL + "/api/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []*Job{}
+	json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if len(jobs) != 2 {
+		t.Fatalf("expect 2 jobs, got %+v", jobs)
+	}
+	if jobs[0].Status != JobDone || jobs[0].DocId == "" {
+		t.Errorf("expect first job done, got %+v", jobs[0])
+	}
+	if jobs[1].Status != JobFailed || jobs[1].Attempts != 1 || jobs[1].Error != "404 Not Found" {
+		t.Errorf("expect second job failed without retry, got %+v", jobs[1])
+	}
+	if doc, _ := get_doc(jobs[0].DocId); doc == nil || doc.Title != "Go scheduler" {
+		t.Errorf("expect indexed doc, got %+v", doc)
+	}
+
+	//stopped workers leave queued jobs for the next start
+	job, err := queue_job(pages.URL + "/scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run_workers(Daemon{Concurrency: 2, MaxAttempts: 2}, stop).Wait()
+	if pending, _ := list_jobs(JobPending); len(pending) != 1 || pending[0].Id != job.Id || pending[0].Attempts != 0 {
+		t.Errorf("expect job left pending, got %+v", pending)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// search modes, match searches the keyword as natural text, fuzzy, prefix and bool
+// parse the keyword into terms, "phrases" and AND/OR/NOT and differ in how terms match
+const (
+	ModeMatch  = "match"
+	ModeFuzzy  = "fuzzy"
+	ModePrefix = "prefix"
+	ModePhrase = "phrase"
+	ModeBool   = "bool"
+)
+
+// max edit distance supported by bleve
+const maxfuzziness = 2
+
+func valid_mode(mode string) bool {
+	switch mode {
+	case ModeMatch, ModeFuzzy, ModePrefix, ModePhrase, ModeBool:
+		return true
+	}
+	return false
+}
+
+// kinds of keyword tokens
+const (
+	tokword = iota
+	tokphrase
+	tokand
+	tokor
+	toknot
+	toklparen
+	tokrparen
+)
+
+type keywordtoken struct {
+	Kind int
+	Text string
+}
+
+// keywordnode is a parsed keyword, Op is and, or, not, word or phrase
+type keywordnode struct {
+	Op       string
+	Text     string
+	Children []*keywordnode
+}
+
+// lex_keyword splits keyword into tokens, quotes may be escaped by backslash inside a phrase,
+// an unterminated phrase runs to the end, everything else but spaces and parens is part of a word
+func lex_keyword(keyword string) []keywordtoken {
+	tokens := []keywordtoken{}
+	runes := []rune(keyword)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, keywordtoken{Kind: toklparen})
+			i++
+		case r == ')':
+			tokens = append(tokens, keywordtoken{Kind: tokrparen})
+			i++
+		case r == '"':
+			phrase := []rune{}
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				phrase = append(phrase, runes[i])
+			}
+			i++
+			if text := strings.TrimSpace(string(phrase)); text != "" {
+				tokens = append(tokens, keywordtoken{Kind: tokphrase, Text: text})
+			}
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			word := string(runes[start:i])
+			switch {
+			case word == "AND" || word == "&&":
+				tokens = append(tokens, keywordtoken{Kind: tokand})
+			case word == "OR" || word == "||":
+				tokens = append(tokens, keywordtoken{Kind: tokor})
+			case word == "NOT":
+				tokens = append(tokens, keywordtoken{Kind: toknot})
+			case strings.HasPrefix(word, "-") || strings.HasPrefix(word, "+"):
+				//-word excludes, +word is required which terms are by default,
+				//a sign followed by a phrase or group applies to it
+				if word[0] == '-' {
+					tokens = append(tokens, keywordtoken{Kind: toknot})
+				}
+				if word = strings.TrimLeft(word, "-+"); word != "" {
+					tokens = append(tokens, keywordtoken{Kind: tokword, Text: word})
+				}
+			default:
+				tokens = append(tokens, keywordtoken{Kind: tokword, Text: word})
+			}
+		}
+	}
+	return tokens
+}
+
+// keywordparser parses tokens into nodes, it never fails: stray operators and parens
+// are ignored and unclosed groups end with the keyword
+type keywordparser struct {
+	tokens []keywordtoken
+	pos    int
+}
+
+// parse_keyword parses keyword, terms next to each other are joined by AND,
+// returns nil if there is nothing to search
+func parse_keyword(keyword string) *keywordnode {
+	p := &keywordparser{tokens: lex_keyword(keyword)}
+	nodes := []*keywordnode{}
+	for p.pos < len(p.tokens) {
+		if node := p.parse_or(); node != nil {
+			nodes = append(nodes, node)
+		}
+		//skip an unmatched close paren
+		if p.pos < len(p.tokens) && p.tokens[p.pos].Kind == tokrparen {
+			p.pos++
+		}
+	}
+	return join_nodes("and", nodes)
+}
+
+func (p *keywordparser) peek() int {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].Kind
+	}
+	return -1
+}
+
+func (p *keywordparser) parse_or() *keywordnode {
+	nodes := []*keywordnode{}
+	if node := p.parse_and(); node != nil {
+		nodes = append(nodes, node)
+	}
+	for p.peek() == tokor {
+		p.pos++
+		if node := p.parse_and(); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return join_nodes("or", nodes)
+}
+
+func (p *keywordparser) parse_and() *keywordnode {
+	nodes := []*keywordnode{}
+	for {
+		switch p.peek() {
+		case -1, tokor, tokrparen:
+			return join_nodes("and", nodes)
+		case tokand:
+			p.pos++
+		default:
+			if node := p.parse_unary(); node != nil {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+}
+
+func (p *keywordparser) parse_unary() *keywordnode {
+	switch p.peek() {
+	case -1, tokor, tokrparen:
+		//NOT with nothing to exclude
+		return nil
+	case toknot:
+		p.pos++
+		node := p.parse_unary()
+		if node == nil {
+			return nil
+		}
+		return &keywordnode{Op: "not", Children: []*keywordnode{node}}
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.Kind {
+	case toklparen:
+		node := p.parse_or()
+		if p.peek() == tokrparen {
+			p.pos++
+		}
+		return node
+	case tokword:
+		return &keywordnode{Op: "word", Text: token.Text}
+	case tokphrase:
+		return &keywordnode{Op: "phrase", Text: token.Text}
+	}
+	//a stray AND or OR
+	return nil
+}
+
+func join_nodes(op string, nodes []*keywordnode) *keywordnode {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	return &keywordnode{Op: op, Children: nodes}
+}
+
+// mode_query builds query of keyword in the search mode of opts
+func mode_query(keyword string, opts *searchoptions) (query.Query, error) {
+	switch opts.Mode {
+	case "", ModeMatch:
+		return keyword_query(keyword, opts.Boost), nil
+	case ModePhrase:
+		return fields_query(opts.Boost, func() fieldquery {
+			return bleve.NewMatchPhraseQuery(strings.Trim(keyword, "\" "))
+		}), nil
+	case ModeFuzzy, ModePrefix, ModeBool:
+		if opts.Fuzziness < 0 || opts.Fuzziness > maxfuzziness {
+			return nil, fmt.Errorf("invalid fuzziness %v, max is %v", opts.Fuzziness, maxfuzziness)
+		}
+		node := parse_keyword(keyword)
+		if node == nil {
+			return bleve.NewMatchNoneQuery(), nil
+		}
+		return node_query(node, opts), nil
+	}
+	return nil, fmt.Errorf("unknown mode %v", opts.Mode)
+}
+
+// node_query builds query of parsed keyword
+func node_query(node *keywordnode, opts *searchoptions) query.Query {
+	switch node.Op {
+	case "word":
+		return word_query(node.Text, opts)
+	case "phrase":
+		return fields_query(opts.Boost, func() fieldquery {
+			return bleve.NewMatchPhraseQuery(node.Text)
+		})
+	case "not":
+		return query.NewBooleanQuery([]query.Query{bleve.NewMatchAllQuery()}, nil, []query.Query{node_query(node.Children[0], opts)})
+	case "or":
+		queries := []query.Query{}
+		for _, child := range node.Children {
+			queries = append(queries, node_query(child, opts))
+		}
+		return bleve.NewDisjunctionQuery(queries...)
+	}
+
+	//and, excluded children become must not clauses
+	must, mustnot := []query.Query{}, []query.Query{}
+	for _, child := range node.Children {
+		if child.Op == "not" {
+			mustnot = append(mustnot, node_query(child.Children[0], opts))
+		} else {
+			must = append(must, node_query(child, opts))
+		}
+	}
+	if len(mustnot) == 0 {
+		return bleve.NewConjunctionQuery(must...)
+	}
+	if len(must) == 0 {
+		must = append(must, bleve.NewMatchAllQuery())
+	}
+	return query.NewBooleanQuery(must, nil, mustnot)
+}
+
+// word_query matches a single word in text fields and tags, words with * or ? are wildcards,
+// in prefix mode words match as prefixes and in fuzzy mode latin words match with typos
+func word_query(word string, opts *searchoptions) query.Query {
+	lower := strings.ToLower(word)
+	var leaf func() fieldquery
+	var tag fieldquery
+	switch {
+	case strings.Trim(word, "*?") == "":
+		return bleve.NewMatchAllQuery()
+	case strings.ContainsAny(word, "*?"):
+		leaf = func() fieldquery { return bleve.NewWildcardQuery(lower) }
+		tag = bleve.NewWildcardQuery(lower)
+	case opts.Mode == ModePrefix:
+		leaf = func() fieldquery { return bleve.NewPrefixQuery(lower) }
+		tag = bleve.NewPrefixQuery(lower)
+	case opts.Mode == ModeFuzzy && fuzzy_word(word, opts.Fuzziness):
+		leaf = func() fieldquery {
+			q := bleve.NewMatchQuery(word)
+			q.SetFuzziness(opts.Fuzziness)
+			return q
+		}
+		tag = bleve.NewFuzzyQuery(lower)
+		tag.(*query.FuzzyQuery).SetFuzziness(opts.Fuzziness)
+	default:
+		leaf = func() fieldquery { return bleve.NewMatchQuery(word) }
+		tag = bleve.NewTermQuery(lower)
+	}
+
+	q := fields_query(opts.Boost, leaf)
+	if opts.Boost.Tags <= 0 {
+		return q
+	}
+	tag.SetField("Tags")
+	tag.SetBoost(opts.Boost.Tags)
+	return bleve.NewDisjunctionQuery(q, tag)
+}
+
+// fuzzy_word reports whether word is latin text long enough to allow typos,
+// cjk words are not matched fuzzily since one character changes the meaning
+func fuzzy_word(word string, fuzziness int) bool {
+	if fuzziness == 0 {
+		return false
+	}
+	letters := 0
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			if !unicode.Is(unicode.Latin, r) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters > fuzziness*2
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// node_string prints parsed keyword in prefix notation
+func node_string(node *keywordnode) string {
+	if node == nil {
+		return ""
+	}
+	switch node.Op {
+	case "word":
+		return node.Text
+	case "phrase":
+		return `"` + node.Text + `"`
+	}
+	children := []string{}
+	for _, child := range node.Children {
+		children = append(children, node_string(child))
+	}
+	return node.Op + "(" + strings.Join(children, " ") + ")"
+}
+
+func TestParseKeyword(t *testing.T) {
+	for keyword, expect := range map[string]string{
+		"go channel":                      "and(go channel)",
+		"go OR rust":                      "or(go rust)",
+		"go AND (channel OR pool) -java":  "and(go or(channel pool) not(java))",
+		`"worker pool" NOT "thread pool"`: `and("worker pool" not("thread pool"))`,
+		`say "hi \"there\""`:              `and(say "hi "there"")`,
+		`"unterminated phrase`:            `"unterminated phrase"`,
+		"c++:templates a:b":               "and(c++:templates a:b)",
+		"tf-idf pipe*":                    "and(tf-idf pipe*)",
+		"go ((rust":                       "and(go rust)",
+		"go ) rust":                       "and(go rust)",
+		"AND OR NOT":                      "",
+		"go NOT":                          "go",
+		"-(java OR php) go":               "and(not(or(java php)) go)",
+	} {
+		if got := node_string(parse_keyword(keyword)); got != expect {
+			t.Errorf("%v: expect %v, got %v", keyword, expect, got)
+		}
+	}
+}
+
+func TestFuzzyWord(t *testing.T) {
+	for word, expect := range map[string]bool{
+		"pipline":    true,
+		"go":         false,
+		"goroutine1": true,
+		"并发编程":       false,
+	} {
+		if got := fuzzy_word(word, 1); got != expect {
+			t.Errorf("%v: expect %v, got %v", word, expect, got)
+		}
+	}
+}
+
+func TestSearchModes(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Title: "Go Concurrency Patterns: Pipelines and cancellation", Content: "A pipeline is a series of stages connected by channels."},
+		{Id: "1530403200", Title: "A beginner's sourdough bread", Content: "Sourdough bread is leavened by a starter of wild yeast."},
+		{Id: "1538352000", Title: "The history of bread", Content: "Bread is one of the oldest prepared foods."},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		Mode    string
+		Keyword string
+		Expect  string
+	}{
+		{ModeFuzzy, "piplines", "1514764800"},
+		{ModePrefix, "sourd", "1530403200"},
+		{ModePhrase, "oldest prepared", "1538352000"},
+		{ModeBool, "bread NOT sourdough", "1538352000"},
+		{ModeBool, `"stages connected" OR yeast`, "1514764800,1530403200"},
+		{ModeBool, `weird:input (with "quotes`, ""},
+	} {
+		res, err := run_search(&searchoptions{Keyword: c.Keyword, Mode: c.Mode, Fuzziness: 1, Boost: default_boost()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, hit := range res.Hits {
+			ids = append(ids, hit.ID)
+		}
+		sorted := strings.Split(c.Expect, ",")
+		if c.Expect == "" {
+			sorted = []string{}
+		}
+		if !same_ids(ids, sorted) {
+			t.Errorf("%v %v: expect %v, got %v", c.Mode, c.Keyword, sorted, ids)
+		}
+	}
+}
+
+// same_ids reports whether a and b contain the same ids regardless of order
+func same_ids(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, id := range a {
+		seen[id]++
+	}
+	for _, id := range b {
+		if seen[id] == 0 {
+			return false
+		}
+		seen[id]--
+	}
+	return true
+}
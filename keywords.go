@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// number of keywords extracted for each doc
+const keywordcount = 10
+
+// doc_keywords extracts top keywords of doc, chinese text by jieba's tf-idf extractor
+// and english text by tf-idf computed over indexed english docs
+func doc_keywords(doc *Doc) []string {
+	text := doc.Title + "\n" + doc.Content
+	if doc_language(doc) == "en" {
+		return english_keywords(text, keywordcount)
+	}
+	keywords := []string{}
+	for _, word := range jieba.Extract(text, keywordcount) {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			keywords = append(keywords, word)
+		}
+	}
+	return keywords
+}
+
+// english_keywords ranks words of text by term frequency and the inverse document frequency
+// of their stems in english content of the index, stop words and short words are skipped
+func english_keywords(text string, n int) []string {
+	analyzer := idx.Mapping().AnalyzerNamed(analyzeren)
+	if analyzer == nil {
+		return nil
+	}
+
+	//count words by their stem, keep the most used spelling to show
+	tf := map[string]int{}
+	spellings := map[string]map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "-")
+		if len([]rune(word)) < 3 {
+			continue
+		}
+		tokens := analyzer.Analyze([]byte(word))
+		if len(tokens) != 1 {
+			continue
+		}
+		stem := string(tokens[0].Term)
+		tf[stem]++
+		if spellings[stem] == nil {
+			spellings[stem] = map[string]int{}
+		}
+		spellings[stem][word]++
+	}
+	if len(tf) == 0 {
+		return nil
+	}
+
+	total, err := idx.DocCount()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	i, _, err := idx.Advanced()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	reader, err := i.Reader()
+	if err != nil {
+		logrus.Error(err)
+		return nil
+	}
+	defer reader.Close()
+
+	type termscore struct {
+		Term  string
+		Score float64
+	}
+	scores := []termscore{}
+	for stem, count := range tf {
+		df := uint64(0)
+		if tfr, err := reader.TermFieldReader([]byte(stem), "en.Content", false, false, false); err == nil {
+			df = tfr.Count()
+			tfr.Close()
+		}
+		idf := math.Log(float64(total+1) / float64(df+1))
+		scores = append(scores, termscore{Term: stem, Score: float64(count) * (1 + idf)})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Term < scores[j].Term
+	})
+
+	keywords := []string{}
+	for _, score := range scores {
+		if len(keywords) >= n {
+			break
+		}
+		keywords = append(keywords, top_spelling(spellings[score.Term]))
+	}
+	return keywords
+}
+
+func top_spelling(spellings map[string]int) string {
+	top, count := "", 0
+	for spelling, c := range spellings {
+		if c > count || (c == count && spelling < top) {
+			top, count = spelling, c
+		}
+	}
+	return top
+}
+
+// suggest_tags returns keywords of doc not yet its tags, keywords already used
+// as tags on other docs come first
+func suggest_tags(doc *Doc) ([]string, error) {
+	keywords := doc.Keywords
+	if len(keywords) == 0 {
+		keywords = doc_keywords(doc)
+	}
+	counts, err := facet_terms("Tags", 1000)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, term := range counts {
+		used[term.Term] = true
+	}
+
+	suggestions := []string{}
+	for _, keyword := range keywords {
+		if tag := normalize_tag(keyword); !has_tag(doc, tag) && used[tag] {
+			suggestions = append(suggestions, tag)
+		}
+	}
+	for _, keyword := range keywords {
+		if tag := normalize_tag(keyword); !has_tag(doc, tag) && !used[tag] {
+			suggestions = append(suggestions, tag)
+		}
+	}
+	return suggestions, nil
+}
+
+func tag_suggest(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "suggest")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	doc, err := get_doc(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if doc == nil {
+		logrus.Error("未找到数据")
+		return nil
+	}
+
+	suggestions, err := suggest_tags(doc)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(suggestions) == 0 {
+		logrus.Info("未找到标签")
+		return nil
+	}
+	if n := c.Int("add"); n > 0 {
+		if n > len(suggestions) {
+			n = len(suggestions)
+		}
+		doc.Tags = append(doc.Tags, suggestions[:n]...)
+		if err := save_doc(doc); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("tags of %v: %v", doc.Id, strings.Join(doc.Tags, ", "))
+		return nil
+	}
+	for _, tag := range suggestions {
+		fmt.Println(tag)
+	}
+	return nil
+}
+
+func keyword_list(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	counts, err := facet_terms("Keywords", c.Int("size"))
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(counts) == 0 {
+		logrus.Info("未找到关键词")
+		return nil
+	}
+	for _, term := range counts {
+		fmt.Printf("%v\t%v\n", term.Term, term.Count)
+	}
+	return nil
+}
+
+// keywords_label formats keywords for output
+func keywords_label(keywords []string) string {
+	if len(keywords) == 0 {
+		return ""
+	}
+	return "\n\t\tkeywords: " + strings.Join(keywords, ", ")
+}
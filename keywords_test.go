@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnglishKeywords(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Title: "Go pipelines", Content: "Goroutines connected by channels form a pipeline in Go."},
+		{Id: "1517443200", Title: "Worker pools in Go", Content: "A worker pool in Go receives jobs from channels."},
+		{Id: "1519862400", Title: "Go modules", Content: "Go modules record dependency versions."},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//channels is more frequent but in most docs, scheduler is in none, the and of are stop words
+	keywords := english_keywords("The channels of the scheduler, channels and the scheduler and channels", 2)
+	if len(keywords) != 2 || keywords[0] != "scheduler" || keywords[1] != "channels" {
+		t.Errorf("unexpected keywords %v", keywords)
+	}
+	for _, keyword := range keywords {
+		if keyword == "the" || keyword == "and" {
+			t.Errorf("stop word %v in keywords", keyword)
+		}
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	if err := save_doc(&Doc{Id: "1514764800", Title: "Go pipelines", Tags: []string{"concurrency"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &Doc{Id: "1517443200", Keywords: []string{"pool", "Concurrency", "go"}, Tags: []string{"go"}}
+	suggestions, err := suggest_tags(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 || suggestions[0] != "concurrency" || suggestions[1] != "pool" {
+		t.Errorf("unexpected suggestions %v", suggestions)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"unicode"
+)
+
+// langtext is title, headings and content of a doc indexed with the analyzer of its language
+type langtext struct {
+	Title    string
+	Headings []string
+	Content  string
+}
+
+// detect_language guesses language of text from the scripts it is written in,
+// returns zh, ja, ko, en or empty if unknown
+func detect_language(text string) string {
+	han, kana, hangul, latin := 0, 0, 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	//cjk text uses far less characters than latin text for the same content,
+	//a few percent of cjk characters is enough to make it a cjk doc
+	cjk := han + kana + hangul
+	if cjk > 0 && cjk*10 >= latin {
+		switch {
+		case hangul > han+kana:
+			return "ko"
+		case kana*10 >= han:
+			return "ja"
+		default:
+			return "zh"
+		}
+	}
+	if latin > 0 {
+		return "en"
+	}
+	return ""
+}
+
+// lang_field returns the language sub document text of lang is indexed under
+func lang_field(lang string) string {
+	switch lang {
+	case "en":
+		return "en"
+	case "ja", "ko":
+		return "cjk"
+	default:
+		return "zh"
+	}
+}
+
+// doc_language returns language of doc, detected from title and content if not set
+func doc_language(doc *Doc) string {
+	if doc.Language != "" {
+		return doc.Language
+	}
+	return detect_language(doc.Title + "\n" + doc.Content)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"Building a worker pool in golang":                "en",
+		"在 golang 中使用 goroutine 和 channel 构建 worker pool": "zh",
+		"ゴルーチンとチャネルでワーカープールを作る":                           "ja",
+		"고루틴과 채널로 워커 풀 만들기":                               "ko",
+		"1234 !!": "",
+	}
+	for text, lang := range cases {
+		if l := detect_language(text); l != lang {
+			t.Errorf("%v: expect %v, got %v", text, lang, l)
+		}
+	}
+}
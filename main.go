@@ -9,7 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/blevesearch/bleve"
 	"github.com/boltdb/bolt"
@@ -37,42 +37,723 @@ func main() {
 		{
 			Name:      "url",
 			Aliases:   []string{"u"},
-			Usage:     "read content from url and index the main content",
+			Usage:     "queue urls for the daemon to read and index their main content",
 			Action:    index_url,
-			ArgsUsage: "absolute url",
+			ArgsUsage: "absolute url...",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "now",
+					Usage: "index right away instead of queueing for the daemon",
+				},
+			},
 		},
 		{
 			Name:      "del",
 			Aliases:   []string{"d"},
-			Usage:     "delete content from index by id",
+			Usage:     "delete content from database and index by id",
 			Action:    del_id,
 			ArgsUsage: "doc id",
 		},
 		{
 			Name:      "read",
 			Aliases:   []string{"r"},
-			Usage:     "read content from index by id",
+			Usage:     "read content from database by id",
 			Action:    read_id,
 			ArgsUsage: "doc id",
 		},
+		{
+			Name:  "saved",
+			Usage: "manage saved searches, new docs matching them are reported to hooks",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "save a search",
+					Action:    saved_add,
+					ArgsUsage: "name, keyword",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "mode, m",
+							Usage: "search mode: match, fuzzy, prefix, phrase or bool",
+							Value: ModeMatch,
+						},
+						cli.StringFlag{
+							Name:  "exec",
+							Usage: "command run by sh when a new doc matches, overrides hooks in config",
+						},
+						cli.StringFlag{
+							Name:  "webhook",
+							Usage: "url to POST to when a new doc matches, overrides hooks in config",
+						},
+					},
+				},
+				{
+					Name:   "list",
+					Usage:  "list saved searches",
+					Action: saved_list,
+				},
+				{
+					Name:      "run",
+					Usage:     "run a saved search",
+					Action:    saved_run,
+					ArgsUsage: "name",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "limit, n",
+							Usage: "max number of results",
+							Value: 10,
+						},
+						cli.StringFlag{
+							Name:  "sort",
+							Usage: "sort results by score or date",
+							Value: "score",
+						},
+						cli.StringFlag{
+							Name:  "since",
+							Usage: "only show docs added since date, e.g. 2018-01-02 or 30d",
+						},
+					},
+				},
+				{
+					Name:      "del",
+					Usage:     "delete saved searches",
+					Action:    saved_del,
+					ArgsUsage: "name...",
+				},
+			},
+		},
+		{
+			Name:      "suggest",
+			Usage:     "complete a search from previous searches and indexed terms",
+			Action:    suggest,
+			ArgsUsage: "partial keyword",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of suggestions",
+					Value: 10,
+				},
+			},
+		},
+		{
+			Name:      "related",
+			Usage:     "find docs similar to a doc",
+			Action:    related,
+			ArgsUsage: "doc id",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of results",
+					Value: 10,
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "output format, table, json or ids",
+					Value: "table",
+				},
+			},
+		},
 		{
 			Name:      "search",
 			Aliases:   []string{"s"},
 			Usage:     "search in read history",
 			Action:    search,
-			ArgsUsage: "keyword",
+			ArgsUsage: "keyword [tag:name] [collection:name] [starred:true] [site:domain] [month:2018-03] [author:name]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "status",
+					Usage: "only show docs with link status (alive, redirected, notfound, gone, changed, error)",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of results",
+					Value: 10,
+				},
+				cli.IntFlag{
+					Name:  "offset",
+					Usage: "skip the first results",
+				},
+				cli.StringFlag{
+					Name:  "sort",
+					Usage: "sort results by score or date",
+					Value: "score",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only show docs added since date, e.g. 2018-01-02 or 30d",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only show docs added until date, e.g. 2018-01-02 or 30d",
+				},
+				cli.StringFlag{
+					Name:  "site",
+					Usage: "only show docs from domain",
+				},
+				cli.StringFlag{
+					Name:  "mode, m",
+					Usage: "search mode: match, fuzzy, prefix, phrase or bool, all but match and phrase accept \"phrases\", AND, OR, NOT, -word, (groups) and wild*cards",
+					Value: ModeMatch,
+				},
+				cli.IntFlag{
+					Name:  "fuzziness",
+					Usage: "max edit distance of latin words in fuzzy mode, 1 or 2, defaults to config",
+				},
+				cli.BoolFlag{
+					Name:  "raw",
+					Usage: "pass keyword to bleve as query string",
+				},
+				cli.BoolFlag{
+					Name:  "facets",
+					Usage: "count results by site, month, author and language, add the printed filter to the keyword to drill down",
+				},
+				cli.IntFlag{
+					Name:  "facet-size",
+					Usage: "max number of terms of each facet",
+					Value: 10,
+				},
+				cli.StringSliceFlag{
+					Name:  "boost",
+					Usage: "override boost in config as name=weight, names are title, headings, tags, notes, highlights, content, phrase, recency and halflife",
+				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "output format, table, json or ids",
+					Value: "table",
+				},
+			},
 		},
 		{
 			Name:    "history",
 			Aliases: []string{"hi"},
 			Usage:   "show all indexed urls",
 			Action:  history,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "status",
+					Usage: "only show docs with link status (alive, redirected, notfound, gone, changed, error)",
+				},
+				cli.StringFlag{
+					Name:  "state",
+					Usage: "only show docs with read state (unread, reading, read, archived)",
+				},
+				cli.BoolFlag{
+					Name:  "unread",
+					Usage: "only show unread docs, same as --state unread",
+				},
+			},
+		},
+		{
+			Name:  "tag",
+			Usage: "manage tags of docs",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "add tags to doc",
+					Action:    tag_add,
+					ArgsUsage: "doc id, tag...",
+				},
+				{
+					Name:      "remove",
+					Aliases:   []string{"rm"},
+					Usage:     "remove tags from doc",
+					Action:    tag_remove,
+					ArgsUsage: "doc id, tag...",
+				},
+				{
+					Name:      "suggest",
+					Usage:     "suggest tags from keywords of doc",
+					Action:    tag_suggest,
+					ArgsUsage: "doc id",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "add",
+							Usage: "add the first n suggestions to doc",
+						},
+					},
+				},
+				{
+					Name:   "list",
+					Usage:  "list tags with doc counts",
+					Action: tag_list,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "size",
+							Usage: "max number of tags",
+							Value: 100,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "keywords",
+			Usage:  "list extracted keywords with doc counts",
+			Action: keyword_list,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "size",
+					Usage: "max number of keywords",
+					Value: 100,
+				},
+			},
+		},
+		{
+			Name:      "collection",
+			Usage:     "put doc into collection, empty name to remove",
+			Action:    set_collection,
+			ArgsUsage: "doc id, collection name",
+		},
+		{
+			Name:      "note",
+			Usage:     "set note of doc, open $EDITOR if note is omitted",
+			Action:    edit_note,
+			ArgsUsage: "doc id, [note]",
+		},
+		{
+			Name:      "star",
+			Usage:     "star docs",
+			Action:    star,
+			ArgsUsage: "doc id...",
+		},
+		{
+			Name:      "unstar",
+			Usage:     "unstar docs",
+			Action:    unstar,
+			ArgsUsage: "doc id...",
+		},
+		{
+			Name:    "highlight",
+			Aliases: []string{"hl"},
+			Usage:   "manage highlights of docs",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "highlight a passage of doc",
+					Action:    highlight_add,
+					ArgsUsage: "doc id, quote",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "prefix",
+							Usage: "text right before the quote, to tell repeated quotes apart",
+						},
+						cli.StringFlag{
+							Name:  "suffix",
+							Usage: "text right after the quote, to tell repeated quotes apart",
+						},
+						cli.StringFlag{
+							Name:  "note",
+							Usage: "note on the highlight",
+						},
+					},
+				},
+				{
+					Name:      "list",
+					Usage:     "list highlights, of all docs if doc id is omitted",
+					Action:    highlight_list,
+					ArgsUsage: "[doc id]",
+				},
+				{
+					Name:      "del",
+					Usage:     "delete highlights",
+					Action:    highlight_del,
+					ArgsUsage: "highlight id...",
+				},
+				{
+					Name:   "export",
+					Usage:  "export all highlights as markdown grouped by doc",
+					Action: highlight_export,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "write to file instead of stdout",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:      "state",
+			Usage:     "change read state of doc",
+			Action:    mark_state,
+			ArgsUsage: "doc id, unread|reading|read|archived",
+		},
+		{
+			Name:      "progress",
+			Usage:     "record reading progress of doc in percent",
+			Action:    mark_progress,
+			ArgsUsage: "doc id, percent",
+		},
+		{
+			Name:   "serve",
+			Usage:  "serve http api",
+			Action: serve,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "addr",
+					Usage: "listen address",
+					Value: "127.0.0.1:8080",
+				},
+			},
+		},
+		{
+			Name:   "daemon",
+			Usage:  "process queued urls and serve http api",
+			Action: daemon,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "addr",
+					Usage: "listen address, defaults to daemon.addr in config",
+				},
+				cli.IntFlag{
+					Name:  "concurrency",
+					Usage: "number of workers, defaults to daemon.concurrency in config",
+				},
+				cli.Float64Flag{
+					Name:  "rps",
+					Usage: "requests per second to each host, defaults to fetch.host_rps in config or 0.2",
+					Value: 0.2,
+				},
+			},
+		},
+		{
+			Name:   "jobs",
+			Usage:  "show status of queued urls",
+			Action: jobs_list,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "status",
+					Usage: "only show jobs with status (pending, running, done, failed)",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "show the latest n jobs",
+					Value: 20,
+				},
+			},
+		},
+		{
+			Name:      "sitemap",
+			Usage:     "queue urls of sitemaps that are not in the store yet",
+			Action:    sitemap,
+			ArgsUsage: "sitemap url...",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only urls modified since date, like 2018-01-01 or 30d",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only urls modified until date",
+				},
+				cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "only urls matching one of the regexps",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "skip urls matching any of the regexps",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print matched urls instead of queuing them",
+				},
+			},
+		},
+		{
+			Name:      "crawl",
+			Usage:     "index pages of a site following links from seed, run again to resume, lists crawls without seed",
+			Action:    crawl_site,
+			ArgsUsage: "[seed url]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "depth",
+					Usage: "follow links this many hops from seed",
+					Value: 3,
+				},
+				cli.StringFlag{
+					Name:  "prefix",
+					Usage: "only crawl paths under prefix, defaults to the directory of seed",
+				},
+				cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "only crawl urls matching one of the regexps",
+				},
+				cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "do not crawl urls matching any of the regexps",
+				},
+				cli.BoolFlag{
+					Name:  "sitemap",
+					Usage: "also start from pages in sitemap.xml of the site",
+				},
+				cli.IntFlag{
+					Name:  "concurrency",
+					Usage: "number of workers, defaults to daemon.concurrency in config",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "fetch at most n pages in this run, 0 for no limit",
+				},
+				cli.Float64Flag{
+					Name:  "rps",
+					Usage: "requests per second to the site, defaults to fetch.host_rps in config or 1",
+					Value: 1,
+				},
+				cli.BoolFlag{
+					Name:  "ignore-robots",
+					Usage: "do not honor robots.txt",
+				},
+				cli.BoolFlag{
+					Name:  "restart",
+					Usage: "drop the state of a previous crawl of seed and start over",
+				},
+			},
+		},
+		{
+			Name:      "check",
+			Aliases:   []string{"c"},
+			Usage:     "re-check indexed urls and record link status",
+			Action:    check,
+			ArgsUsage: "[doc id...]",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "interval",
+					Usage: "keep running and re-check every interval, e.g. 24h",
+				},
+			},
+		},
+		{
+			Name:  "feed",
+			Usage: "manage feed subscriptions, new entries are indexed when polled",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					Usage:     "subscribe to rss, atom or json feeds and index their entries",
+					Action:    feed_add,
+					ArgsUsage: "feed url...",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "title",
+							Usage: "title of the feed, defaults to the title in the feed",
+						},
+						cli.BoolFlag{
+							Name:  "skip-existing",
+							Usage: "only index entries published after subscribing",
+						},
+					},
+				},
+				{
+					Name:   "list",
+					Usage:  "list subscriptions",
+					Action: feed_list,
+				},
+				{
+					Name:      "remove",
+					Usage:     "unsubscribe from feeds, indexed docs are kept",
+					Action:    feed_remove,
+					ArgsUsage: "feed url...",
+				},
+				{
+					Name:   "export",
+					Usage:  "export subscriptions as opml",
+					Action: feed_export,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "write to file instead of stdout",
+						},
+					},
+				},
+				{
+					Name:      "import",
+					Usage:     "subscribe to feeds of an opml file",
+					Action:    feed_import,
+					ArgsUsage: "opml file",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "skip-existing",
+							Usage: "only index entries published after subscribing",
+						},
+					},
+				},
+				{
+					Name:      "poll",
+					Usage:     "fetch feeds and index new entries",
+					Action:    feed_poll,
+					ArgsUsage: "[feed url...]",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "interval",
+							Usage: "keep running and poll every interval, e.g. 1h",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "digest",
+			Usage:  "email a digest of docs indexed in a period",
+			Action: send_digest,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "docs added since date, e.g. 2018-01-02 or 7d",
+					Value: "1d",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "docs added until date",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of docs",
+					Value: 100,
+				},
+				cli.StringSliceFlag{
+					Name:  "to",
+					Usage: "recipients, override smtp.to in config",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "write the email as .eml file instead of sending it",
+				},
+			},
+		},
+		{
+			Name:      "epub",
+			Usage:     "export docs as an epub book to read on e-readers",
+			Action:    epub,
+			ArgsUsage: "[doc id...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tag",
+					Usage: "docs with tag when no id is given",
+				},
+				cli.StringFlag{
+					Name:  "collection",
+					Usage: "docs in collection when no id is given",
+				},
+				cli.StringFlag{
+					Name:  "saved",
+					Usage: "docs matching saved search when no id is given",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "docs added since date, e.g. 2018-01-02 or 7d",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "docs added until date",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of docs",
+					Value: 50,
+				},
+				cli.StringFlag{
+					Name:  "title",
+					Usage: "title of the book",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "epub file, defaults to readengine-{date}.epub",
+				},
+			},
+		},
+		{
+			Name:   "publish",
+			Usage:  "generate an atom or rss feed of recently indexed docs",
+			Action: publish,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format, f",
+					Usage: "atom or rss",
+					Value: FormatAtom,
+				},
+				cli.StringFlag{
+					Name:  "tag",
+					Usage: "only docs with tag",
+				},
+				cli.StringFlag{
+					Name:  "collection",
+					Usage: "only docs in collection",
+				},
+				cli.StringFlag{
+					Name:  "saved",
+					Usage: "only docs matching saved search",
+				},
+				cli.IntFlag{
+					Name:  "limit, n",
+					Usage: "max number of docs",
+					Value: 20,
+				},
+				cli.StringFlag{
+					Name:  "title",
+					Usage: "title of the feed",
+				},
+				cli.StringFlag{
+					Name:  "link",
+					Usage: "absolute url the feed is published at",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "write to file instead of stdout",
+				},
+			},
+		},
+		{
+			Name:   "migrate-store",
+			Usage:  "copy the database to another backend",
+			Action: migrate_store,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "backend to copy to, bolt or sqlite",
+				},
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "backend to copy from, defaults to backend in config",
+				},
+			},
+		},
+		{
+			Name:   "migrate",
+			Usage:  "upgrade the database to the schema of this version",
+			Action: migrate,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "report what would change without writing",
+				},
+			},
 		},
 		{
 			Name:    "rebuild",
 			Aliases: []string{"r"},
 			Usage:   "rebuild index from database",
 			Action:  rebuild,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "incremental",
+					Usage: "only reindex docs modified since the last rebuild",
+				},
+				cli.IntFlag{
+					Name:  "batch",
+					Value: rebuildbatch,
+					Usage: "number of docs indexed in a batch",
+				},
+			},
+		},
+		{
+			Name:   "fsck",
+			Usage:  "check that database and index agree",
+			Action: fsck,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "repair",
+					Usage: "fix problems found",
+				},
+			},
 		},
 	}
 	app.Run(os.Args)
@@ -82,7 +763,8 @@ var (
 	conf  Conf
 	idx   bleve.Index
 	jieba *gojieba.Jieba
-	db    *bolt.DB
+	db    Store
+	lock  *bolt.DB
 )
 
 type Conf struct {
@@ -92,9 +774,23 @@ type Conf struct {
 	Idf      string `yaml:"idf"`
 	Stop     string `yaml:"stop"`
 	Store    string `yaml:"store"`
+	//bolt or sqlite
+	Backend string `yaml:"backend"`
+	Boost   Boost  `yaml:"boost"`
+	//max edit distance of words in fuzzy search
+	Fuzziness int `yaml:"fuzziness"`
+	//notified when new docs match saved searches
+	Hooks Hooks `yaml:"hooks"`
+	//digests are sent through
+	Smtp SMTP `yaml:"smtp"`
+	//job queue workers
+	Daemon Daemon `yaml:"daemon"`
+	//limits of requests to each host
+	Fetch Fetch `yaml:"fetch"`
 }
 
-func init_engine(c *cli.Context) {
+// load_conf reads config.yaml from ~/.readengine, relative paths in it are resolved against that dir
+func load_conf() {
 	user, err := user.Current()
 	if err != nil {
 		logrus.Fatal(err)
@@ -107,10 +803,15 @@ func init_engine(c *cli.Context) {
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	conf.Boost = default_boost()
+	conf.Fuzziness = 1
+	conf.Daemon = default_daemon()
+	conf.Fetch = default_fetch()
 	err = yaml.Unmarshal(content, &conf)
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	set_politeness(conf.Fetch)
 
 	if conf.Dict == "" || conf.Hmm == "" || conf.UserDict == "" || conf.Idf == "" || conf.Stop == "" {
 		logrus.Fatal("missing configuration for segment")
@@ -137,37 +838,43 @@ func init_engine(c *cli.Context) {
 	} else if !path.IsAbs(conf.Store) {
 		conf.Store = path.Join(configdir, conf.Store)
 	}
+}
+
+func init_engine(c *cli.Context) {
+	open_engine()
+	results, err := migrate_schema(db, store_path(conf.Backend, conf.Store), false)
+	if err != nil {
+		close_engine()
+		logrus.Fatal(err)
+	}
+	if err := reindex_migrated(results); err != nil {
+		logrus.Errorf("%v, run readengine rebuild --incremental to index migrated docs", err)
+	}
+}
+
+// open_engine loads config, locks the store and opens the index and the database without migrating it
+func open_engine() {
+	load_conf()
+
+	//lock store
+	if err := os.MkdirAll(conf.Store, 0755); err != nil {
+		logrus.Fatal(err)
+	}
+	var err error
+	if lock, err = lock_store(conf.Store); err != nil {
+		logrus.Fatal(err)
+	}
 
 	//init index
 	jieba = gojieba.NewJieba(conf.Dict, conf.Hmm, conf.UserDict, conf.Idf, conf.Stop)
 	indexpath := path.Join(conf.Store, "index")
+	restore_index(indexpath)
 	idx, err = bleve.Open(indexpath)
 	if err == bleve.ErrorIndexPathDoesNotExist {
-		mapping := bleve.NewIndexMapping()
-		if err := mapping.AddCustomTokenizer("gojieba", map[string]interface{}{
-			"dictpath":     conf.Dict,
-			"hmmpath":      conf.Hmm,
-			"userdictpath": conf.UserDict,
-			"idf":          conf.Idf,
-			"stop_words":   conf.Stop,
-			"type":         "gojieba",
-		}); err != nil {
+		mapping, err := new_mapping()
+		if err != nil {
 			logrus.Fatal(err)
 		}
-		if err := mapping.AddCustomAnalyzer("gojieba", map[string]interface{}{
-			"type":      "gojieba",
-			"tokenizer": "gojieba",
-		}); err != nil {
-			panic(err)
-		}
-		mapping.DefaultAnalyzer = "gojieba"
-		docmapping := bleve.NewDocumentMapping()
-		fieldidmapping := bleve.NewNumericFieldMapping()
-		docmapping.AddFieldMappingsAt("Id", fieldidmapping)
-		fieldtitlemapping := bleve.NewTextFieldMapping()
-		docmapping.AddFieldMappingsAt("Title", fieldtitlemapping)
-		fieldcontentmapping := bleve.NewTextFieldMapping()
-		docmapping.AddFieldMappingsAt("Content", fieldcontentmapping)
 		idx, err = bleve.New(indexpath, mapping)
 		if err != nil {
 			logrus.Fatal(err)
@@ -177,17 +884,8 @@ func init_engine(c *cli.Context) {
 	}
 
 	//init db
-	datapath := path.Join(conf.Store, "data.db")
-	db, err = bolt.Open(datapath, 0600, nil)
-	if err != nil {
-		logrus.Fatal(err)
-	}
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("readengine"))
-		return err
-	})
+	db, err = open_store(conf.Backend, conf.Store)
 	if err != nil {
-		db.Close()
 		logrus.Fatal(err)
 	}
 }
@@ -197,48 +895,82 @@ func close_engine() {
 	idx.Close()
 	jieba.Free()
 	db.Close()
+	lock.Close()
 }
 
 func index_url(c *cli.Context) error {
 	if c.NArg() == 0 {
 		return cli.ShowCommandHelp(c, "url")
 	}
+	if !c.Bool("now") {
+		return queue_urls(c, c.Args())
+	}
 	init_engine(c)
 	defer close_engine()
 
-	url := c.Args().First()
-	logrus.Infof("indexing %v", url)
+	for _, url := range c.Args() {
+		logrus.Infof("indexing %v", url)
+		doc, err := index_page(url)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("indexed %v", doc.Title)
+		c, _ := idx.DocCount()
+		logrus.Infof("index size: %v", c)
+	}
+	return nil
+}
 
-	title, content, err := extractor.Parse(url)
+// index_page extracts the main content of url, saves and indexes it as a new doc,
+// and reports it to matching saved searches
+func index_page(url string) (*Doc, error) {
+	page, err := extractor.ParseContent(url)
 	if err != nil {
-		logrus.Error(err)
-	} else {
-		doc := &Doc{
-			Id:      strconv.FormatInt(time.Now().Unix(), 10),
-			Src:     url,
-			Title:   title,
-			Content: content,
-		}
-		//save to db
-		db.Update(func(tx *bolt.Tx) error {
-			docbytes, err := json.Marshal(doc)
-			if err != nil {
-				return err
-			}
-			return tx.Bucket([]byte("readengine")).Put([]byte(doc.Id), docbytes)
-		})
+		return nil, err
+	}
+	doc, err := page_doc(url, page)
+	if err != nil {
+		return nil, err
+	}
+	//save to db, then to index
+	if err := save_doc(doc); err != nil {
+		return nil, err
+	}
+	alert_saved(doc)
+	return doc, nil
+}
 
-		//save to index
-		if err := idx.Index(doc.Id, doc); err != nil {
-			logrus.Error(err)
-		} else {
-			logrus.Infof("indexed %v", title)
-			c, _ := idx.DocCount()
-			logrus.Infof("index size: %v", c)
-		}
+// page_doc makes a new doc of page extracted from url
+func page_doc(url string, page *extractor.Content) (*Doc, error) {
+	id, err := new_doc_id()
+	if err != nil {
+		return nil, err
 	}
+	title, content := page.Title, page.Description
+	doc := &Doc{
+		Id:          id,
+		Src:         url,
+		Title:       title,
+		Content:     content,
+		Headings:    page.Headings,
+		Images:      page_images(page),
+		Author:      strings.TrimSpace(page.Author),
+		Published:   unix_time(page.Published),
+		ReadingTime: reading_time(content),
+		Language:    detect_language(title + "\n" + content),
+	}
+	doc.Keywords = doc_keywords(doc)
+	return doc, nil
+}
 
-	return nil
+// page_images returns urls of images of page
+func page_images(page *extractor.Content) []string {
+	urls := []string{}
+	for _, image := range page.Images {
+		urls = append(urls, image.URL)
+	}
+	return urls
 }
 
 func del_id(c *cli.Context) error {
@@ -249,12 +981,16 @@ func del_id(c *cli.Context) error {
 	defer close_engine()
 
 	id := c.Args().First()
-	logrus.Infof("deleting index by id %v", id)
+	logrus.Infof("deleting doc by id %v", id)
 
-	if err := idx.Delete(id); err != nil {
+	found, err := delete_doc(id)
+	if err != nil {
 		logrus.Error(err)
 		return err
 	}
+	if !found {
+		logrus.Error("未找到数据")
+	}
 
 	return nil
 }
@@ -267,9 +1003,10 @@ func read_id(c *cli.Context) error {
 	defer close_engine()
 
 	id := c.Args().First()
-	logrus.Infof("reading index by id %v", id)
+	logrus.Infof("reading doc by id %v", id)
 
-	doc, err := idx.Document(id)
+	//content is only indexed in language sub documents, so the doc is read from db
+	doc, err := get_doc(id)
 	if err != nil {
 		logrus.Error(err)
 		return err
@@ -280,98 +1017,83 @@ func read_id(c *cli.Context) error {
 		return nil
 	}
 
-	for _, field := range doc.Fields {
-		fmt.Printf("%s: %s", field.Name(), string(field.Value()))
+	for _, field := range [][2]string{{"Id", doc.Id}, {"Src", doc.Src}, {"Title", doc.Title}, {"Content", doc.Content}} {
+		fmt.Printf("%s: %s", field[0], field[1])
 	}
 
 	return nil
 }
 
-func search(c *cli.Context) error {
-	if c.NArg() == 0 {
-		return cli.ShowCommandHelp(c, "search")
-	}
+func history(c *cli.Context) error {
 	init_engine(c)
 	defer close_engine()
 
-	keyword := c.Args().First()
-
-	req := bleve.NewSearchRequest(bleve.NewQueryStringQuery("Title:" + keyword + " Content:" + keyword))
-	req.Fields = []string{"Id", "Src", "Title"}
-	req.Highlight = bleve.NewHighlight()
-
-	res, err := idx.Search(req)
-	if err != nil {
-		logrus.Error(err)
-	} else {
-		if res.Total > 0 {
-			logrus.Infof("找到 %v 条结果", res.Total)
-			for _, doc := range res.Hits {
-				addtime, _ := strconv.Atoi(doc.ID)
-				logrus.Infof("[%s][%v]title: %v\n\t\tsrc: %v", doc.ID, gotime.TimeToStr(int64(addtime), gotime.FORMAT_YYYY_MM_DD_HH_II_SS), doc.Fields["Title"], doc.Fields["Src"])
-			}
-		} else {
-			logrus.Info("未找到结果")
-		}
+	status := c.String("status")
+	state := c.String("state")
+	if c.Bool("unread") {
+		state = StateUnread
 	}
-	return nil
-}
-
-func rebuild(c *cli.Context) error {
-	init_engine(c)
-	defer close_engine()
-
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("readengine"))
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+	db.View(func(tx *Tx) error {
+		return tx.Iterate("readengine", "", func(k string, v []byte) error {
 			doc := Doc{}
 			if err := json.Unmarshal(v, &doc); err != nil {
 				logrus.Error(err)
-			} else {
-				logrus.Infof("indexing %v", doc.Src)
-				if err := idx.Index(doc.Id, doc); err != nil {
-					logrus.Error(err)
-				}
+			} else if (status == "" || doc.Status == status) && (state == "" || read_state(&doc) == state) {
+				addtime, _ := strconv.Atoi(doc.Id)
+				logrus.Infof("[%v]%v title: %v\n\t\tsrc: %v %v%v%v", gotime.TimeToStr(int64(addtime), gotime.FORMAT_YYYY_MM_DD_HH_II_SS), state_label(&doc), doc.Title, doc.Src, status_label(doc.Status), tags_label(doc.Tags), keywords_label(doc.Keywords))
 			}
-		}
-		return nil
+			return nil
+		})
 	})
 
 	count, _ := idx.DocCount()
-	logrus.Infof("rebuild index finished, index size: %v", count)
+	logrus.Infof("index size: %v", count)
 
 	return nil
 }
 
-func history(c *cli.Context) error {
-	init_engine(c)
-	defer close_engine()
+type Doc struct {
+	Id       string
+	Src      string
+	Title    string
+	Content  string
+	Headings []string
+	//urls of images in the page, embedded when exported to epub
+	Images []string
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("readengine"))
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			doc := Doc{}
-			if err := json.Unmarshal(v, &doc); err != nil {
-				logrus.Error(err)
-			} else {
-				addtime, _ := strconv.Atoi(doc.Id)
-				logrus.Infof("[%v]title: %v\n\t\tsrc: %v", gotime.TimeToStr(int64(addtime), gotime.FORMAT_YYYY_MM_DD_HH_II_SS), doc.Title, doc.Src)
-			}
-		}
-		return nil
-	})
+	Author string
+	//url of the feed the doc was ingested from
+	Feed string
+	//unix seconds the doc was published, 0 if unknown
+	Published int64
 
-	count, _ := idx.DocCount()
-	logrus.Infof("index size: %v", count)
+	//zh, en, ja, ko or empty if unknown
+	Language string
+	//top keywords extracted from title and content
+	Keywords []string
 
-	return nil
-}
+	//organized by user
+	Tags       []string
+	Collection string
+	Note       string
+	Starred    bool
 
-type Doc struct {
-	Id      string
-	Src     string
-	Title   string
-	Content string
+	//reading
+	ReadState   string
+	Progress    float64
+	StartedAt   int64
+	ReadAt      int64
+	ArchivedAt  int64
+	ReadingTime int
+
+	//link status from the last check
+	Status       string
+	StatusCode   int
+	Location     string
+	CheckedAt    int64
+	ETag         string
+	LastModified string
+
+	//unix nanoseconds of the last save to db
+	ModifiedAt int64
 }
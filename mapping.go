@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/porter"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/mapping"
+)
+
+// analyzers of languages, text of a doc is indexed under the sub document of
+// its language so that each language gets its own analyzer
+const (
+	//gojieba for chinese, english words in between are lowercased and stemmed
+	analyzerzh = "zh"
+	//bleve english analyzer with porter stemmer and stop words
+	analyzeren = en.AnalyzerName
+	//cjk bigram for japanese and korean, latin words are stemmed like english
+	analyzercjk = "cjk_en"
+	//gojieba segments without stemming, terms are suggested as typed
+	analyzersuggest = "suggest"
+)
+
+// language sub documents and their analyzers
+var langanalyzers = map[string]string{
+	"zh":  analyzerzh,
+	"en":  analyzeren,
+	"cjk": analyzercjk,
+}
+
+// new_mapping returns the index mapping of docs
+func new_mapping() (*mapping.IndexMappingImpl, error) {
+	indexmapping := bleve.NewIndexMapping()
+	if err := indexmapping.AddCustomTokenizer("gojieba", map[string]interface{}{
+		"dictpath":     conf.Dict,
+		"hmmpath":      conf.Hmm,
+		"userdictpath": conf.UserDict,
+		"idf":          conf.Idf,
+		"stop_words":   conf.Stop,
+		"type":         "gojieba",
+	}); err != nil {
+		return nil, err
+	}
+	if err := indexmapping.AddCustomAnalyzer(analyzerzh, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     "gojieba",
+		"token_filters": []interface{}{lowercase.Name, en.StopName, porter.Name},
+	}); err != nil {
+		return nil, err
+	}
+	if err := indexmapping.AddCustomAnalyzer(analyzercjk, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []interface{}{cjk.WidthName, lowercase.Name, cjk.BigramName, en.StopName, porter.Name},
+	}); err != nil {
+		return nil, err
+	}
+	if err := indexmapping.AddCustomAnalyzer(analyzersuggest, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     "gojieba",
+		"token_filters": []interface{}{lowercase.Name, en.StopName},
+	}); err != nil {
+		return nil, err
+	}
+	indexmapping.DefaultAnalyzer = analyzerzh
+
+	docmapping := bleve.NewDocumentMapping()
+	fieldidmapping := bleve.NewNumericFieldMapping()
+	docmapping.AddFieldMappingsAt("Id", fieldidmapping)
+	//title is kept for display, title, headings and content are searched in language sub documents
+	fieldtitlemapping := bleve.NewTextFieldMapping()
+	fieldtitlemapping.Index = false
+	fieldtitlemapping.IncludeInAll = false
+	docmapping.AddFieldMappingsAt("Title", fieldtitlemapping)
+	fieldcontentmapping := bleve.NewTextFieldMapping()
+	fieldcontentmapping.Index = false
+	fieldcontentmapping.Store = false
+	fieldcontentmapping.IncludeInAll = false
+	docmapping.AddFieldMappingsAt("Content", fieldcontentmapping)
+	fieldheadingsmapping := bleve.NewTextFieldMapping()
+	fieldheadingsmapping.Index = false
+	fieldheadingsmapping.Store = false
+	fieldheadingsmapping.IncludeInAll = false
+	docmapping.AddFieldMappingsAt("Headings", fieldheadingsmapping)
+	for lang, analyzer := range langanalyzers {
+		langmapping := bleve.NewDocumentMapping()
+		fieldlangtitlemapping := bleve.NewTextFieldMapping()
+		fieldlangtitlemapping.Analyzer = analyzer
+		langmapping.AddFieldMappingsAt("Title", fieldlangtitlemapping)
+		fieldlangheadingsmapping := bleve.NewTextFieldMapping()
+		fieldlangheadingsmapping.Analyzer = analyzer
+		langmapping.AddFieldMappingsAt("Headings", fieldlangheadingsmapping)
+		fieldlangcontentmapping := bleve.NewTextFieldMapping()
+		fieldlangcontentmapping.Analyzer = analyzer
+		langmapping.AddFieldMappingsAt("Content", fieldlangcontentmapping)
+		docmapping.AddSubDocumentMapping(lang, langmapping)
+	}
+	fieldsuggestmapping := bleve.NewTextFieldMapping()
+	fieldsuggestmapping.Analyzer = analyzersuggest
+	fieldsuggestmapping.Store = false
+	fieldsuggestmapping.IncludeInAll = false
+	docmapping.AddFieldMappingsAt("Suggest", fieldsuggestmapping)
+	docmapping.AddFieldMappingsAt("Language", keyword_field())
+	docmapping.AddFieldMappingsAt("Author", keyword_field())
+	docmapping.AddFieldMappingsAt("Feed", keyword_field())
+	docmapping.AddFieldMappingsAt("Keywords", keyword_field())
+	docmapping.AddFieldMappingsAt("Status", keyword_field())
+	fieldcheckedmapping := bleve.NewNumericFieldMapping()
+	docmapping.AddFieldMappingsAt("CheckedAt", fieldcheckedmapping)
+	docmapping.AddFieldMappingsAt("Tags", keyword_field())
+	docmapping.AddFieldMappingsAt("Collection", keyword_field())
+	fieldnotemapping := bleve.NewTextFieldMapping()
+	docmapping.AddFieldMappingsAt("Note", fieldnotemapping)
+	fieldstarredmapping := bleve.NewBooleanFieldMapping()
+	docmapping.AddFieldMappingsAt("Starred", fieldstarredmapping)
+	docmapping.AddFieldMappingsAt("ReadState", keyword_field())
+	fieldprogressmapping := bleve.NewNumericFieldMapping()
+	docmapping.AddFieldMappingsAt("Progress", fieldprogressmapping)
+	fieldreadingtimemapping := bleve.NewNumericFieldMapping()
+	docmapping.AddFieldMappingsAt("ReadingTime", fieldreadingtimemapping)
+	fieldaddedmapping := bleve.NewDateTimeFieldMapping()
+	docmapping.AddFieldMappingsAt("Added", fieldaddedmapping)
+	docmapping.AddFieldMappingsAt("Domain", keyword_field())
+	fieldhighlightsmapping := bleve.NewTextFieldMapping()
+	docmapping.AddFieldMappingsAt("Highlights", fieldhighlightsmapping)
+	fieldhighlightnotesmapping := bleve.NewTextFieldMapping()
+	docmapping.AddFieldMappingsAt("HighlightNotes", fieldhighlightnotesmapping)
+	indexmapping.DefaultMapping = docmapping
+
+	return indexmapping, nil
+}
+
+// keyword_field is a text field indexed as a single term
+func keyword_field() *mapping.FieldMapping {
+	fieldmapping := bleve.NewTextFieldMapping()
+	fieldmapping.Analyzer = keyword.Name
+	return fieldmapping
+}
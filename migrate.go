@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// migration upgrades records of the schema version before it, run returns keys of the changed records,
+// which are ids of docs to index again if reindex
+type migration struct {
+	name    string
+	run     func(tx *Tx) ([]string, error)
+	reindex bool
+}
+
+// migrations in order, the schema version is the number of migrations applied,
+// append new ones and never change or remove released ones
+var migrations = []migration{
+	{name: "extract keywords of docs saved without them", run: migrate_keywords, reindex: true},
+	{name: "detect language and reading time of docs saved without them", run: migrate_language, reindex: true},
+	{name: "stamp modified time of docs saved without it", run: migrate_modified},
+	{name: "index secondary keys of records saved before them", run: migrate_secondaries},
+}
+
+// schemaversion is the version of the schema this build writes
+var schemaversion = len(migrations)
+
+// rollbackdryrun rolls back migrations of a dry run
+var rollbackdryrun = errors.New("dry run")
+
+// schema_version returns the version of records in tx, stores without it are version 0
+func schema_version(tx *Tx) (int, error) {
+	v, err := tx.Get("meta", "schema")
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(v))
+}
+
+func set_schema_version(tx *Tx, version int) error {
+	return tx.Put("meta", "schema", []byte(strconv.Itoa(version)))
+}
+
+// migrationresult is what a migration changed
+type migrationresult struct {
+	Version int
+	Name    string
+	Keys    []string
+	Reindex bool
+}
+
+// reindex_migrated indexes docs changed by migrations again so that the index agrees with db
+func reindex_migrated(results []migrationresult) error {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if !r.Reindex {
+			continue
+		}
+		for _, id := range r.Keys {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	logrus.Infof("reindexing %v migrated docs", len(ids))
+	return index_ids_batch(idx, ids, rebuildbatch)
+}
+
+// migrate_schema runs migrations newer than the version of store in one transaction,
+// a dry run reports what they would change and rolls back. A store is backed up before it is changed,
+// new stores are stamped with the current version.
+func migrate_schema(store Store, backup string, dryrun bool) ([]migrationresult, error) {
+	from := 0
+	fresh := false
+	err := store.View(func(tx *Tx) error {
+		var err error
+		if from, err = schema_version(tx); err != nil {
+			return err
+		}
+		buckets, err := tx.Buckets()
+		fresh = len(buckets) == 0
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if from > schemaversion {
+		return nil, fmt.Errorf("store has schema version %v, newer than %v of this readengine", from, schemaversion)
+	}
+	if from == schemaversion {
+		return nil, nil
+	}
+	if fresh {
+		if dryrun {
+			return nil, nil
+		}
+		return nil, store.Update(func(tx *Tx) error {
+			return set_schema_version(tx, schemaversion)
+		})
+	}
+
+	if !dryrun && backup != "" {
+		file := fmt.Sprintf("%v.v%v-%v.bak", backup, from, time.Now().Format("20060102150405"))
+		logrus.Infof("backing up store to %v before migrating from schema version %v to %v", file, from, schemaversion)
+		if err := store.Backup(file); err != nil {
+			return nil, err
+		}
+	}
+
+	results := []migrationresult{}
+	err = store.Update(func(tx *Tx) error {
+		for version := from + 1; version <= schemaversion; version++ {
+			m := migrations[version-1]
+			keys, err := m.run(tx)
+			if err != nil {
+				return fmt.Errorf("migration %v %v: %v", version, m.name, err)
+			}
+			results = append(results, migrationresult{Version: version, Name: m.name, Keys: keys, Reindex: m.reindex})
+		}
+		if dryrun {
+			return rollbackdryrun
+		}
+		return set_schema_version(tx, schemaversion)
+	})
+	if err == rollbackdryrun {
+		err = nil
+	}
+	return results, err
+}
+
+// migrate_docs saves docs that change returns true for with a new modified time so that
+// an incremental rebuild reindexes them, returns their ids
+func migrate_docs(tx *Tx, change func(doc *Doc) bool) ([]string, error) {
+	now := time.Now().UnixNano()
+	changed := []*Doc{}
+	err := tx.Iterate("readengine", "", func(k string, v []byte) error {
+		doc := &Doc{}
+		if err := json.Unmarshal(v, doc); err != nil {
+			logrus.Errorf("doc %v: %v", k, err)
+			return nil
+		}
+		if change(doc) {
+			changed = append(changed, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, doc := range changed {
+		doc.ModifiedAt = now
+		bs, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Put("readengine", doc.Id, bs); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.Id)
+	}
+	return ids, nil
+}
+
+func migrate_keywords(tx *Tx) ([]string, error) {
+	return migrate_docs(tx, func(doc *Doc) bool {
+		if len(doc.Keywords) > 0 {
+			return false
+		}
+		doc.Keywords = doc_keywords(doc)
+		return len(doc.Keywords) > 0
+	})
+}
+
+func migrate_language(tx *Tx) ([]string, error) {
+	return migrate_docs(tx, func(doc *Doc) bool {
+		changed := false
+		if doc.Language == "" {
+			if doc.Language = detect_language(doc.Title + "\n" + doc.Content); doc.Language != "" {
+				changed = true
+			}
+		}
+		if doc.ReadingTime == 0 {
+			if doc.ReadingTime = reading_time(doc.Content); doc.ReadingTime != 0 {
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+func migrate_modified(tx *Tx) ([]string, error) {
+	return migrate_docs(tx, func(doc *Doc) bool {
+		return doc.ModifiedAt == 0
+	})
+}
+
+// migrate_secondaries fills secondary keys of records missing them, returns keys of those records
+func migrate_secondaries(tx *Tx) ([]string, error) {
+	keys := []string{}
+	for _, s := range secondaries {
+		records := map[string][]byte{}
+		err := tx.Iterate(s.bucket, "", func(k string, v []byte) error {
+			for _, value := range s.keys(v) {
+				if indexed, err := tx.raw.get(secondary_bucket(s.bucket, s.name), value+"\x00"+k); err != nil {
+					return err
+				} else if indexed == nil {
+					records[k] = append([]byte{}, v...)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range records {
+			if err := tx.index(s.bucket, k, v); err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func migrate(c *cli.Context) error {
+	open_engine()
+	defer close_engine()
+
+	dryrun := c.Bool("dry-run")
+	from := 0
+	if err := db.View(func(tx *Tx) (err error) {
+		from, err = schema_version(tx)
+		return err
+	}); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	results, err := migrate_schema(db, store_path(conf.Backend, conf.Store), dryrun)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(results) == 0 {
+		logrus.Infof("schema version %v is up to date", from)
+		return nil
+	}
+
+	verb := "changed"
+	if dryrun {
+		verb = "would change"
+	}
+	for _, r := range results {
+		ids := r.Keys
+		if len(ids) > 10 {
+			ids = append(ids[:10:10], "...")
+		}
+		logrus.Infof("%v %v: %v %v docs %v", r.Version, r.Name, verb, len(r.Keys), strings.Join(ids, " "))
+	}
+	if dryrun {
+		logrus.Infof("would migrate schema version %v to %v", from, schemaversion)
+		return nil
+	}
+	logrus.Infof("migrated schema version %v to %v", from, schemaversion)
+	if err := reindex_migrated(results); err != nil {
+		logrus.Errorf("%v, run readengine rebuild --incremental to index migrated docs", err)
+		return err
+	}
+	return nil
+}
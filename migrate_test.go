@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateSchema(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	//a store written before versioning, one doc has keywords and language already
+	olddocs := map[string]string{
+		"1514764800": `{"Id":"1514764800","Src":"https://a.com","Title":"Go pipelines","Content":"Goroutines connected by channels form a pipeline in Go."}`,
+		"1517443200": `{"Id":"1517443200","Src":"https://b.com","Title":"Worker pools","Content":"A worker pool receives jobs from channels.","Keywords":["pool"],"Language":"en","ReadingTime":1,"ModifiedAt":1517443200000000000}`,
+	}
+	err := db.Update(func(tx *Tx) error {
+		for k, v := range olddocs {
+			if err := tx.Put("readengine", k, []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backup := filepath.Join(dir, "data.db")
+
+	//a dry run reports changes and writes nothing
+	results, err := migrate_schema(db, backup, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(migrations) {
+		t.Fatalf("expect %v migrations, got %v", len(migrations), results)
+	}
+	//later migrations see docs changed by earlier ones in the same transaction
+	for _, r := range results[:2] {
+		if len(r.Keys) != 1 || r.Keys[0] != "1514764800" {
+			t.Errorf("migration %v expect to change 1514764800, got %v", r.Version, r.Keys)
+		}
+	}
+	db.View(func(tx *Tx) error {
+		if version, err := schema_version(tx); err != nil || version != 0 {
+			t.Errorf("expect version 0 after dry run, got %v %v", version, err)
+		}
+		for k, v := range olddocs {
+			if record, _ := tx.Get("readengine", k); string(record) != v {
+				t.Errorf("doc %v changed by dry run: %s", k, record)
+			}
+		}
+		return nil
+	})
+	if files, _ := filepath.Glob(backup + "*"); len(files) != 0 {
+		t.Errorf("dry run backed up store %v", files)
+	}
+
+	results, err = migrate_schema(db, backup, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//only docs changed by migrations are indexed again
+	if err := reindex_migrated(results); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := index_ids(); err != nil || len(ids) != 1 || !ids["1514764800"] {
+		t.Errorf("expect migrated doc indexed, got %v %v", ids, err)
+	}
+	if files, _ := filepath.Glob(backup + ".v0-*.bak"); len(files) != 1 {
+		t.Errorf("expect a backup of version 0, got %v", files)
+	}
+	db.View(func(tx *Tx) error {
+		if version, err := schema_version(tx); err != nil || version != schemaversion {
+			t.Errorf("expect version %v, got %v %v", schemaversion, version, err)
+		}
+		doc := Doc{}
+		v, _ := tx.Get("readengine", "1514764800")
+		if err := json.Unmarshal(v, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.Keywords) == 0 || doc.Language != "en" || doc.ReadingTime == 0 || doc.ModifiedAt == 0 {
+			t.Errorf("doc not migrated %+v", doc)
+		}
+		if v, _ := tx.Get("readengine", "1517443200"); string(v) != olddocs["1517443200"] {
+			t.Errorf("doc changed without need: %s", v)
+		}
+		return nil
+	})
+
+	//migrated stores are left alone
+	if results, err := migrate_schema(db, backup, false); err != nil || len(results) != 0 {
+		t.Errorf("expect nothing to migrate, got %v %v", results, err)
+	}
+
+	//stores of a newer readengine are refused
+	db.Update(func(tx *Tx) error {
+		return set_schema_version(tx, schemaversion+1)
+	})
+	if _, err := migrate_schema(db, backup, false); err == nil {
+		t.Error("expect error migrating a newer schema")
+	}
+}
+
+func TestMigrateNewStore(t *testing.T) {
+	for _, backend := range []string{BackendBolt, BackendSqlite} {
+		t.Run(backend, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "readengine")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			store, err := open_store(backend, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			//new stores get the current version without a backup
+			if results, err := migrate_schema(store, store_path(backend, dir), false); err != nil || len(results) != 0 {
+				t.Fatalf("expect nothing to migrate, got %v %v", results, err)
+			}
+			store.View(func(tx *Tx) error {
+				if version, err := schema_version(tx); err != nil || version != schemaversion {
+					t.Errorf("expect version %v, got %v %v", schemaversion, version, err)
+				}
+				return nil
+			})
+			if files, _ := filepath.Glob(filepath.Join(dir, "*.bak")); len(files) != 0 {
+				t.Errorf("new store backed up %v", files)
+			}
+
+			//backups open as a store of the same backend
+			backup := filepath.Join(dir, "backup")
+			if err := store.Backup(backup); err != nil {
+				t.Fatal(err)
+			}
+			var copied Store
+			if backend == BackendBolt {
+				copied, err = open_bolt(backup)
+			} else {
+				copied, err = open_sqlite(backup)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer copied.Close()
+			copied.View(func(tx *Tx) error {
+				if version, err := schema_version(tx); err != nil || version != schemaversion {
+					t.Errorf("expect version %v in backup, got %v %v", schemaversion, version, err)
+				}
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// formats of published feeds
+const (
+	FormatAtom = "atom"
+	FormatRSS  = "rss"
+)
+
+// max runes of content in the summary of a published entry
+const summarylength = 500
+
+var ErrUnknownFormat = errors.New("unknown feed format, use atom or rss")
+
+// publishoptions selects the recently indexed docs to publish as a feed
+type publishoptions struct {
+	Format     string
+	Tag        string
+	Collection string
+	Saved      string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Title      string
+	//absolute url the feed is published at
+	Link string
+}
+
+// published_docs returns the latest docs matching the tag, collection, saved search and dates of opts
+func published_docs(opts *publishoptions) ([]*Doc, error) {
+	queries := []query.Query{}
+	if opts.Saved != "" {
+		s, err := get_saved(opts.Saved)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			return nil, fmt.Errorf("saved search %v not found", opts.Saved)
+		}
+		q, _, err := build_query(saved_options(s))
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	if opts.Tag != "" {
+		queries = append(queries, filter_query("tag", opts.Tag))
+	}
+	if opts.Collection != "" {
+		queries = append(queries, filter_query("collection", opts.Collection))
+	}
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		datequery := bleve.NewDateRangeQuery(opts.Since, opts.Until)
+		datequery.SetField("Added")
+		queries = append(queries, datequery)
+	}
+	var q query.Query = bleve.NewMatchAllQuery()
+	if len(queries) > 0 {
+		q = bleve.NewConjunctionQuery(queries...)
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	req := bleve.NewSearchRequestOptions(q, limit, 0, false)
+	req.SortBy([]string{"-Added"})
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	docs := []*Doc{}
+	for _, hit := range res.Hits {
+		doc, err := get_doc(hit.ID)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// feed_title describes the selection of opts unless a title is given
+func feed_title(opts *publishoptions) string {
+	if opts.Title != "" {
+		return opts.Title
+	}
+	parts := []string{}
+	if opts.Tag != "" {
+		parts = append(parts, "tag "+opts.Tag)
+	}
+	if opts.Collection != "" {
+		parts = append(parts, "collection "+opts.Collection)
+	}
+	if opts.Saved != "" {
+		parts = append(parts, "saved search "+opts.Saved)
+	}
+	if len(parts) == 0 {
+		return "ReadEngine"
+	}
+	return "ReadEngine: " + strings.Join(parts, ", ")
+}
+
+// doc_summary is the note of doc followed by the beginning of its content
+func doc_summary(doc *Doc) string {
+	content := excerpt(doc.Content, summarylength)
+	if doc.Note != "" {
+		return doc.Note + "\n\n" + content
+	}
+	return content
+}
+
+type atomlink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomtext struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomcategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomentry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Link       atomlink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     *atomauthor    `xml:"author,omitempty"`
+	Categories []atomcategory `xml:"category"`
+	Summary    atomtext       `xml:"summary"`
+}
+
+type atomauthor struct {
+	Name string `xml:"name"`
+}
+
+type atomfeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Links   []atomlink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomauthor  `xml:"author"`
+	Entries []atomentry `xml:"entry"`
+}
+
+type rssitem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssfeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssitem `xml:"channel>item"`
+}
+
+// render_feed renders docs as atom or rss
+func render_feed(docs []*Doc, opts *publishoptions) ([]byte, error) {
+	title := feed_title(opts)
+	updated := time.Now()
+	if len(docs) > 0 {
+		updated = doc_added(docs[0])
+	}
+
+	var v interface{}
+	switch opts.Format {
+	case "", FormatAtom:
+		feed := atomfeed{
+			Title:   title,
+			Id:      opts.Link,
+			Updated: updated.Format(time.RFC3339),
+			Author:  atomauthor{Name: "ReadEngine"},
+		}
+		if feed.Id == "" {
+			feed.Id = "urn:readengine:" + strings.ToLower(strings.Replace(title, " ", "-", -1))
+		} else {
+			feed.Links = append(feed.Links, atomlink{Href: opts.Link, Rel: "self"})
+		}
+		for _, doc := range docs {
+			added := doc_added(doc).Format(time.RFC3339)
+			entry := atomentry{
+				Title:     doc.Title,
+				Id:        "urn:readengine:" + doc.Id,
+				Link:      atomlink{Href: doc.Src},
+				Published: added,
+				Updated:   added,
+				Summary:   atomtext{Type: "text", Text: doc_summary(doc)},
+			}
+			if doc.Author != "" {
+				entry.Author = &atomauthor{Name: doc.Author}
+			}
+			for _, tag := range doc.Tags {
+				entry.Categories = append(entry.Categories, atomcategory{Term: tag})
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		v = feed
+	case FormatRSS:
+		feed := rssfeed{
+			Version:       "2.0",
+			Title:         title,
+			Link:          opts.Link,
+			Description:   title,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+		}
+		for _, doc := range docs {
+			feed.Items = append(feed.Items, rssitem{
+				Title:       doc.Title,
+				Link:        doc.Src,
+				Guid:        doc.Src,
+				PubDate:     doc_added(doc).Format(time.RFC1123Z),
+				Categories:  doc.Tags,
+				Description: doc_summary(doc),
+			})
+		}
+		v = feed
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	bs, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(bs, '\n')...), nil
+}
+
+// feed_content_type is the content type a feed of format is served with
+func feed_content_type(format string) string {
+	if format == FormatRSS {
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+func publish(c *cli.Context) error {
+	opts := &publishoptions{
+		Format:     c.String("format"),
+		Tag:        c.String("tag"),
+		Collection: c.String("collection"),
+		Saved:      c.String("saved"),
+		Limit:      c.Int("limit"),
+		Title:      c.String("title"),
+		Link:       c.String("link"),
+	}
+	if opts.Format != FormatAtom && opts.Format != FormatRSS {
+		logrus.Error(ErrUnknownFormat)
+		return cli.ShowCommandHelp(c, "publish")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	docs, err := published_docs(opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	bs, err := render_feed(docs, opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if output := c.String("output"); output != "" {
+		if err := ioutil.WriteFile(output, bs, 0644); err != nil {
+			logrus.Error(err)
+			return err
+		}
+		logrus.Infof("published %v docs to %v", len(docs), output)
+	} else {
+		fmt.Print(string(bs))
+	}
+	return nil
+}
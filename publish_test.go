@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+func TestPublishedDocs(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Src: "https://blog.golang.org/pipelines", Title: "Go pipelines", Content: "Each stage is a goroutine.", Tags: []string{"go"}, Note: "worth sharing"},
+		{Id: "1514851200", Src: "https://medium.com/k8s", Title: "Kubernetes pods", Content: "Pods are scheduled onto nodes.", Tags: []string{"k8s"}, Collection: "ops"},
+		{Id: "1514937600", Src: "https://blog.golang.org/scheduler", Title: "Go scheduler", Content: "The scheduler runs goroutines.", Tags: []string{"go"}},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := put_saved(&SavedSearch{Name: "pods", Query: "pods", Mode: ModeMatch}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		opts   publishoptions
+		expect []string
+	}{
+		{publishoptions{}, []string{"1514937600", "1514851200", "1514764800"}},
+		{publishoptions{Tag: "Go"}, []string{"1514937600", "1514764800"}},
+		{publishoptions{Collection: "ops"}, []string{"1514851200"}},
+		{publishoptions{Saved: "pods"}, []string{"1514851200"}},
+		{publishoptions{Limit: 1}, []string{"1514937600"}},
+	} {
+		docs, err := published_docs(&c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, doc := range docs {
+			ids = append(ids, doc.Id)
+		}
+		if len(ids) != len(c.expect) {
+			t.Errorf("%+v: expect %v, got %v", c.opts, c.expect, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != c.expect[i] {
+				t.Errorf("%+v: expect %v, got %v", c.opts, c.expect, ids)
+				break
+			}
+		}
+	}
+	if _, err := published_docs(&publishoptions{Saved: "missing"}); err == nil {
+		t.Error("expect error of missing saved search")
+	}
+
+	for query, expect := range map[string]int{
+		"?limit=2":       http.StatusOK,
+		"?limit=1000000": http.StatusOK,
+		"?limit=many":    http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		serve_feed(FormatAtom)(w, httptest.NewRequest(http.MethodGet, "/feed.atom"+query, nil))
+		if w.Code != expect {
+			t.Errorf("%v: expect %v, got %v %s", query, expect, w.Code, w.Body)
+		}
+	}
+}
+
+func TestRenderFeed(t *testing.T) {
+	docs := []*Doc{
+		{Id: "1514937600", Src: "https://blog.golang.org/scheduler", Title: "Go scheduler", Author: "Dmitry", Content: "The scheduler runs goroutines.", Tags: []string{"go"}},
+		{Id: "1514764800", Src: "https://blog.golang.org/pipelines", Title: "Go pipelines <&>", Content: "Each stage is a goroutine.", Note: "worth sharing"},
+	}
+	for _, format := range []string{FormatAtom, FormatRSS} {
+		bs, err := render_feed(docs, &publishoptions{Format: format, Tag: "go", Link: "https://example.com/go.xml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed, err := extractor.ParseFeed(bs, "https://example.com/go.xml")
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", format, err, bs)
+		}
+		if feed.Title != "ReadEngine: tag go" || len(feed.Entries) != 2 {
+			t.Fatalf("%v: unexpected feed %+v", format, feed)
+		}
+		entry := feed.Entries[1]
+		if entry.Title != "Go pipelines <&>" || entry.Link != "https://blog.golang.org/pipelines" ||
+			entry.Summary != "worth sharing\n\nEach stage is a goroutine." || entry.Published.Unix() != 1514764800 {
+			t.Errorf("%v: unexpected entry %+v", format, entry)
+		}
+	}
+	if _, err := render_feed(docs, &publishoptions{Format: "html"}); err != ErrUnknownFormat {
+		t.Errorf("expect unknown format, got %v", err)
+	}
+}
+
+func TestOPML(t *testing.T) {
+	subs := []*Subscription{
+		{Url: "https://blog.golang.org/feed.atom", Title: "Go Blog"},
+		{Url: "https://medium.com/feed/tag/kubernetes"},
+	}
+	bs, err := export_opml(subs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parse_opml(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].Title != "Go Blog" || parsed[1].Url != subs[1].Url || parsed[1].Title != subs[1].Url {
+		t.Errorf("unexpected opml round trip %+v %+v", parsed[0], parsed[1])
+	}
+
+	nested := `<opml version="1.0"><head><title>x</title></head><body>
+<outline text="Tech"><outline text="Go Blog" type="rss" xmlUrl="https://blog.golang.org/feed.atom"/></outline>
+<outline text="no feed"/></body></opml>`
+	parsed, err = parse_opml([]byte(nested))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0].Title != "Go Blog" {
+		t.Errorf("unexpected nested opml %+v", parsed)
+	}
+}
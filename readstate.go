@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// read state of docs, docs never touched are unread
+const (
+	StateUnread   = "unread"
+	StateReading  = "reading"
+	StateRead     = "read"
+	StateArchived = "archived"
+)
+
+// reading speed used to estimate reading time
+const (
+	wordsperminute = 200
+	cjkperminute   = 400
+)
+
+func valid_state(state string) bool {
+	switch state {
+	case StateUnread, StateReading, StateRead, StateArchived:
+		return true
+	}
+	return false
+}
+
+// read_state returns state of doc, empty state is unread
+func read_state(doc *Doc) string {
+	if doc.ReadState == "" {
+		return StateUnread
+	}
+	return doc.ReadState
+}
+
+// set_state changes read state of doc and records the time of the change
+func set_state(doc *Doc, state string) error {
+	if !valid_state(state) {
+		return fmt.Errorf("invalid state %v", state)
+	}
+	now := time.Now().Unix()
+	switch state {
+	case StateUnread:
+		doc.StartedAt = 0
+		doc.ReadAt = 0
+		doc.Progress = 0
+	case StateReading:
+		if doc.StartedAt == 0 {
+			doc.StartedAt = now
+		}
+	case StateRead:
+		if doc.StartedAt == 0 {
+			doc.StartedAt = now
+		}
+		doc.ReadAt = now
+		doc.Progress = 100
+	case StateArchived:
+		doc.ArchivedAt = now
+	}
+	doc.ReadState = state
+	return nil
+}
+
+// set_progress records reading progress in percent, moves doc to reading or read
+func set_progress(doc *Doc, progress float64) error {
+	if progress < 0 || progress > 100 {
+		return fmt.Errorf("invalid progress %v", progress)
+	}
+	if progress >= 100 {
+		return set_state(doc, StateRead)
+	}
+	doc.Progress = progress
+	if progress > 0 && read_state(doc) != StateReading {
+		return set_state(doc, StateReading)
+	}
+	return nil
+}
+
+// reading_time estimates minutes to read content, CJK characters are counted
+// one by one while other text is counted by words
+func reading_time(content string) int {
+	words, cjk := 0, 0
+	inword := false
+	for _, r := range content {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			cjk++
+			inword = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inword {
+				words++
+			}
+			inword = true
+		default:
+			inword = false
+		}
+	}
+	if words == 0 && cjk == 0 {
+		return 0
+	}
+	minutes := float64(words)/wordsperminute + float64(cjk)/cjkperminute
+	return int(math.Max(1, math.Ceil(minutes)))
+}
+
+func doc_reading_time(doc *Doc) int {
+	if doc.ReadingTime == 0 {
+		return reading_time(doc.Content)
+	}
+	return doc.ReadingTime
+}
+
+// state_label formats read state, progress and reading time for output
+func state_label(doc *Doc) string {
+	state := read_state(doc)
+	if state == StateReading {
+		state += " " + strconv.FormatFloat(doc.Progress, 'f', 0, 64) + "%"
+	}
+	return fmt.Sprintf("[%v][%v min]", state, doc_reading_time(doc))
+}
+
+func mark_state(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "state")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	state := c.Args().Get(1)
+	if !valid_state(state) {
+		return cli.ShowCommandHelp(c, "state")
+	}
+	return update_doc(c.Args().First(), func(doc *Doc) error {
+		if err := set_state(doc, state); err != nil {
+			return err
+		}
+		logrus.Infof("%v %v", doc.Title, state_label(doc))
+		return nil
+	})
+}
+
+func mark_progress(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "progress")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	progress, err := strconv.ParseFloat(c.Args().Get(1), 64)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if progress < 0 || progress > 100 {
+		err := fmt.Errorf("invalid progress %v", progress)
+		logrus.Error(err)
+		return err
+	}
+	return update_doc(c.Args().First(), func(doc *Doc) error {
+		if err := set_progress(doc, progress); err != nil {
+			return err
+		}
+		logrus.Infof("%v %v", doc.Title, state_label(doc))
+		return nil
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadingTime(t *testing.T) {
+	cases := []struct {
+		content string
+		minutes int
+	}{
+		{"", 0},
+		{"hello world", 1},
+		{strings.Repeat("word ", 450), 3},
+		{strings.Repeat("中", 800), 2},
+		{strings.Repeat("中", 400) + strings.Repeat("word ", 200), 2},
+	}
+	for _, cs := range cases {
+		if m := reading_time(cs.content); m != cs.minutes {
+			t.Errorf("expect %v minutes, got %v", cs.minutes, m)
+		}
+	}
+}
+
+func TestSetProgress(t *testing.T) {
+	doc := &Doc{}
+	if err := set_progress(doc, 30); err != nil {
+		t.Fatal(err)
+	}
+	if doc.ReadState != StateReading || doc.StartedAt == 0 {
+		t.Errorf("expect reading, got %+v", doc)
+	}
+	if err := set_progress(doc, 100); err != nil {
+		t.Fatal(err)
+	}
+	if doc.ReadState != StateRead || doc.ReadAt == 0 {
+		t.Errorf("expect read, got %+v", doc)
+	}
+	if err := set_progress(doc, 120); err == nil {
+		t.Error("expect error for invalid progress")
+	}
+}
+
+func TestUpdateDocFailure(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	if err := save_doc(&Doc{Id: "1514764800", Src: "https://a.com", Title: "Go pipelines"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//a failed change is not saved
+	err := update_doc("1514764800", func(doc *Doc) error {
+		doc.Title = "Changed"
+		return set_progress(doc, 120)
+	})
+	if err == nil {
+		t.Error("expect error for invalid progress")
+	}
+	if doc, err := get_doc("1514764800"); err != nil || doc.Title != "Go pipelines" || doc.ReadState != "" {
+		t.Errorf("expect doc unchanged, got %+v %v", doc, err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// number of docs indexed in a batch by default
+const rebuildbatch = 500
+
+// internal key of the index holding unix nanoseconds when its last rebuild started,
+// docs modified after it are reindexed by an incremental rebuild
+var builtkey = []byte("built")
+
+func rebuild(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	size := c.Int("batch")
+	if size <= 0 {
+		size = rebuildbatch
+	}
+	var err error
+	if c.Bool("incremental") {
+		var built int64
+		if built, err = index_built(idx); err == nil && built == 0 {
+			logrus.Info("index was never rebuilt, rebuilding all docs")
+			err = rebuild_all(path.Join(conf.Store, "index"), size)
+		} else if err == nil {
+			err = rebuild_changed(built, size)
+		}
+	} else {
+		err = rebuild_all(path.Join(conf.Store, "index"), size)
+	}
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	count, _ := idx.DocCount()
+	logrus.Infof("rebuild index finished, index size: %v", count)
+	return nil
+}
+
+// rebuild_all builds a new index of all docs next to the index at indexpath and swaps it in when done,
+// searches keep using the old index meanwhile and it is left untouched if the build fails
+func rebuild_all(indexpath string, size int) error {
+	started := time.Now().UnixNano()
+	ids, err := doc_ids()
+	if err != nil {
+		return err
+	}
+
+	tmppath := indexpath + ".rebuild"
+	if err := os.RemoveAll(tmppath); err != nil {
+		return err
+	}
+	mapping, err := new_mapping()
+	if err != nil {
+		return err
+	}
+	tmp, err := bleve.New(tmppath, mapping)
+	if err != nil {
+		return err
+	}
+	if err := index_ids_batch(tmp, ids, size); err != nil {
+		tmp.Close()
+		os.RemoveAll(tmppath)
+		return err
+	}
+	if err := set_index_built(tmp, started); err != nil {
+		tmp.Close()
+		os.RemoveAll(tmppath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.RemoveAll(tmppath)
+		return err
+	}
+	return swap_index(indexpath, tmppath)
+}
+
+// rebuild_changed reindexes docs modified since built and removes docs deleted from db
+func rebuild_changed(built int64, size int) error {
+	started := time.Now().UnixNano()
+	ids := []string{}
+	stored := map[string]bool{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("readengine", "", func(k string, v []byte) error {
+			stored[k] = true
+			doc := struct{ ModifiedAt int64 }{}
+			if err := json.Unmarshal(v, &doc); err != nil {
+				logrus.Errorf("doc %v: %v", k, err)
+				return nil
+			}
+			if doc.ModifiedAt >= built {
+				ids = append(ids, k)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	changed := len(ids)
+
+	indexed, err := index_ids()
+	if err != nil {
+		return err
+	}
+	for id := range indexed {
+		if !stored[id] {
+			ids = append(ids, id)
+		}
+	}
+	logrus.Infof("%v docs modified and %v deleted since %v", changed, len(ids)-changed, time.Unix(0, built).Format(time.RFC3339))
+
+	if err := index_ids_batch(idx, ids, size); err != nil {
+		return err
+	}
+	return set_index_built(idx, started)
+}
+
+// index_ids_batch indexes docs of ids into index in batches of size, ids missing from db are removed from index
+func index_ids_batch(index bleve.Index, ids []string, size int) error {
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		docs, err := get_docs(ids[start:end])
+		if err != nil {
+			return err
+		}
+		batch := index.NewBatch()
+		for _, id := range ids[start:end] {
+			doc, ok := docs[id]
+			if !ok {
+				batch.Delete(id)
+				continue
+			}
+			if doc == nil {
+				continue
+			}
+			data, err := index_data(doc)
+			if err != nil {
+				return err
+			}
+			if err := batch.Index(id, data); err != nil {
+				return err
+			}
+		}
+		if err := index.Batch(batch); err != nil {
+			return err
+		}
+		logrus.Infof("indexed %v/%v docs", end, len(ids))
+	}
+	return nil
+}
+
+// get_docs loads docs of ids from db in a transaction, docs failing to decode are logged and mapped to nil
+func get_docs(ids []string) (map[string]*Doc, error) {
+	docs := map[string]*Doc{}
+	err := db.View(func(tx *Tx) error {
+		for _, id := range ids {
+			v, err := tx.Get("readengine", id)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			doc := &Doc{}
+			if err := json.Unmarshal(v, doc); err != nil {
+				logrus.Errorf("doc %v: %v", id, err)
+				doc = nil
+			}
+			docs[id] = doc
+		}
+		return nil
+	})
+	return docs, err
+}
+
+// index_built returns when the last rebuild of index started, 0 if never
+func index_built(index bleve.Index) (int64, error) {
+	v, err := index.GetInternal(builtkey)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(v), 10, 64)
+}
+
+func set_index_built(index bleve.Index, built int64) error {
+	return index.SetInternal(builtkey, []byte(strconv.FormatInt(built, 10)))
+}
+
+// swap_index replaces the index in use at indexpath with the one at tmppath and reopens it,
+// the old index is moved aside until the new one is in place so that restore_index can recover from a crash
+func swap_index(indexpath, tmppath string) error {
+	oldpath := indexpath + ".old"
+	if err := os.RemoveAll(oldpath); err != nil {
+		return err
+	}
+	if err := idx.Close(); err != nil {
+		return err
+	}
+	err := os.Rename(indexpath, oldpath)
+	if err == nil {
+		if err = os.Rename(tmppath, indexpath); err != nil {
+			os.Rename(oldpath, indexpath)
+		}
+	}
+	var oerr error
+	if idx, oerr = bleve.Open(indexpath); oerr != nil {
+		logrus.Fatal(oerr)
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(oldpath)
+}
+
+// restore_index moves back the index left aside by a swap that did not finish
+func restore_index(indexpath string) {
+	oldpath := indexpath + ".old"
+	if _, err := os.Stat(indexpath); !os.IsNotExist(err) {
+		return
+	}
+	if _, err := os.Stat(oldpath); err != nil {
+		return
+	}
+	logrus.Warnf("restoring index from %v", oldpath)
+	if err := os.Rename(oldpath, indexpath); err != nil {
+		logrus.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestRebuild(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//rebuilding swaps the index on disk
+	mapping, err := new_mapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Close()
+	indexpath := filepath.Join(dir, "index")
+	if idx, err = bleve.New(indexpath, mapping); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Src: "https://a.com", Title: "Go pipelines", Content: "Goroutines connected by channels."},
+		{Id: "1517443200", Src: "https://b.com", Title: "Worker pools"},
+		{Id: "1519862400", Src: "https://c.com", Title: "Go modules"},
+	} {
+		if err := put_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//stale entry of a doc gone from db
+	if err := index_doc(&Doc{Id: "1400000000", Title: "Stale"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rebuild_all(indexpath, 2); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := index_ids()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || !ids["1514764800"] || !ids["1517443200"] || !ids["1519862400"] {
+		t.Errorf("unexpected docs in rebuilt index %v", ids)
+	}
+	built, err := index_built(idx)
+	if err != nil || built == 0 {
+		t.Fatalf("expect build time, got %v %v", built, err)
+	}
+	for _, p := range []string{indexpath + ".rebuild", indexpath + ".old"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expect %v removed, got %v", p, err)
+		}
+	}
+
+	//an incremental rebuild picks up docs saved and deleted since, and docs whose highlights changed,
+	//the highlighted doc is dropped from index to tell whether it is indexed again
+	if err := put_doc(&Doc{Id: "1522540800", Src: "https://d.com", Title: "Go generics"}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := get_doc("1514764800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add_highlight(doc, "channels", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Delete("1514764800"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *Tx) error {
+		return tx.Delete("readengine", "1517443200")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rebuild_changed(built, 2); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err = index_ids(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || !ids["1522540800"] || !ids["1514764800"] || ids["1517443200"] {
+		t.Errorf("unexpected docs after incremental rebuild %v", ids)
+	}
+	if rebuilt, err := index_built(idx); err != nil || rebuilt <= built {
+		t.Errorf("expect later build time than %v, got %v %v", built, rebuilt, err)
+	}
+}
+
+func TestRestoreIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	indexpath := filepath.Join(dir, "index")
+
+	//a swap interrupted after moving the old index aside
+	if err := os.Mkdir(indexpath+".old", 0755); err != nil {
+		t.Fatal(err)
+	}
+	restore_index(indexpath)
+	if _, err := os.Stat(indexpath); err != nil {
+		t.Errorf("expect index restored, got %v", err)
+	}
+
+	//an index in place is kept
+	if err := os.Mkdir(indexpath+".old", 0755); err != nil {
+		t.Fatal(err)
+	}
+	restore_index(indexpath)
+	if _, err := os.Stat(indexpath + ".old"); err != nil {
+		t.Errorf("expect old index left alone, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"github.com/yanyiwu/gojieba"
+)
+
+// number of keywords extracted from a doc to find related docs
+const relatedkeywords = 20
+
+func related(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "related")
+	}
+	format := c.String("format")
+	if format != "table" && format != "json" && format != "ids" {
+		logrus.Errorf("unknown format %v", format)
+		return cli.ShowCommandHelp(c, "related")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	doc, err := get_doc(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if doc == nil {
+		logrus.Error("未找到数据")
+		return nil
+	}
+
+	res, err := related_docs(doc, c.Int("limit"))
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if res.Total == 0 {
+		logrus.Info("未找到结果")
+		return nil
+	}
+
+	switch format {
+	case "json":
+		return print_json(res)
+	case "ids":
+		for _, hit := range res.Hits {
+			fmt.Println(hit.ID)
+		}
+	default:
+		print_table(res)
+	}
+	return nil
+}
+
+// related_docs finds docs most similar to doc by its top tf-idf keywords
+func related_docs(doc *Doc, limit int) (*bleve.SearchResult, error) {
+	keywords := jieba.ExtractWithWeight(doc.Title+"\n"+doc.Content, relatedkeywords)
+	if limit <= 0 {
+		limit = 10
+	}
+	req := bleve.NewSearchRequestOptions(related_query(doc, keywords), limit, 0, false)
+	req.Fields = resultfields
+	return idx.Search(req)
+}
+
+// related_query matches keywords weighted by their tf-idf in title, headings and content,
+// doc itself is excluded
+func related_query(doc *Doc, keywords []gojieba.WordWeight) query.Query {
+	if len(keywords) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	//only text of the article counts, the weight of the top keyword is 1
+	boost := Boost{Title: conf.Boost.Title, Headings: conf.Boost.Headings, Content: conf.Boost.Content}
+	top := 0.0
+	for _, keyword := range keywords {
+		if keyword.Weight > top {
+			top = keyword.Weight
+		}
+	}
+	matches := []query.Query{}
+	for _, keyword := range keywords {
+		word := keyword.Word
+		q := fields_query(boost, func() fieldquery {
+			return bleve.NewMatchQuery(word)
+		})
+		if top > 0 {
+			if b, ok := q.(query.BoostableQuery); ok {
+				b.SetBoost(keyword.Weight / top)
+			}
+		}
+		matches = append(matches, q)
+	}
+	self := bleve.NewDocIDQuery([]string{doc.Id})
+	return query.NewBooleanQuery([]query.Query{bleve.NewDisjunctionQuery(matches...)}, nil, []query.Query{self})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/yanyiwu/gojieba"
+)
+
+func TestRelatedQuery(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	docs := []*Doc{
+		{Id: "1514764800", Title: "Go pipelines", Content: "Goroutines connected by channels form a pipeline."},
+		{Id: "1517443200", Title: "Worker pools in Go", Content: "A worker pool of goroutines receives jobs from channels."},
+		{Id: "1530403200", Title: "Sourdough bread", Content: "Feed the starter before baking bread."},
+	}
+	for _, doc := range docs {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keywords := []gojieba.WordWeight{{Word: "goroutines", Weight: 2}, {Word: "channels", Weight: 1.5}, {Word: "pipeline", Weight: 1}}
+	req := bleve.NewSearchRequest(related_query(docs[0], keywords))
+	res, err := idx.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != "1517443200" {
+		t.Errorf("expect only the worker pool doc, got %v", res.Hits)
+	}
+
+	if res, err := idx.Search(bleve.NewSearchRequest(related_query(docs[0], nil))); err != nil || res.Total != 0 {
+		t.Errorf("expect nothing without keywords, got %v %v", res, err)
+	}
+}
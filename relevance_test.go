@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/yanyiwu/gojieba"
+)
+
+// relevanceset is a small corpus with queries and the docs expected to answer them,
+// run go test -run Relevance -v to see how a ranking change scores
+type relevanceset struct {
+	Docs    []*Doc
+	Queries []struct {
+		Query    string
+		Relevant []string
+	}
+}
+
+// test_dict is dict of the repo, or the one bundled with gojieba when the repo does not carry it
+func test_dict(dict, bundled string) string {
+	if _, err := os.Stat(dict); err != nil {
+		return bundled
+	}
+	return dict
+}
+
+// open_test_engine opens db in a temp dir and an in memory index, skips when jieba dicts are missing
+func open_test_engine(t *testing.T) func() {
+	conf.Dict = test_dict("dict_jieba/jieba.dict.utf8", gojieba.DICT_PATH)
+	conf.Hmm = test_dict("dict_jieba/hmm_model.utf8", gojieba.HMM_PATH)
+	conf.UserDict = test_dict("dict_jieba/user.dict.utf8", gojieba.USER_DICT_PATH)
+	conf.Idf = test_dict("dict_jieba/idf.utf8", gojieba.IDF_PATH)
+	conf.Stop = test_dict("dict_jieba/stop_words.utf8", gojieba.STOP_WORDS_PATH)
+	conf.Boost = default_boost()
+	conf.Fuzziness = 1
+	for _, dict := range []string{conf.Dict, conf.Hmm, conf.UserDict, conf.Idf, conf.Stop} {
+		if _, err := os.Stat(dict); err != nil {
+			t.Skipf("missing dict %v", dict)
+		}
+	}
+
+	mapping, err := new_mapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = bleve.NewMemOnly(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = open_store(BackendBolt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		idx.Close()
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRelevance(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/relevance.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := relevanceset{}
+	if err := json.Unmarshal(content, &set); err != nil {
+		t.Fatal(err)
+	}
+
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range set.Docs {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//mean reciprocal rank of the first relevant doc and mean recall in the top 3
+	const k = 3
+	mrr, recall := 0.0, 0.0
+	for _, q := range set.Queries {
+		res, err := run_search(&searchoptions{Keyword: q.Query, Limit: 10, Boost: default_boost()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		relevant := map[string]bool{}
+		for _, id := range q.Relevant {
+			relevant[id] = true
+		}
+		rank, found := 0, 0
+		for i, hit := range res.Hits {
+			if !relevant[hit.ID] {
+				continue
+			}
+			if rank == 0 {
+				rank = i + 1
+			}
+			if i < k {
+				found++
+			}
+		}
+		if rank > 0 {
+			mrr += 1 / float64(rank)
+		}
+		expect := len(q.Relevant)
+		if expect > k {
+			expect = k
+		}
+		recall += float64(found) / float64(expect)
+		t.Logf("%-24v first relevant at %v, %v/%v in top %v", q.Query, rank, found, expect, k)
+	}
+	mrr /= float64(len(set.Queries))
+	recall /= float64(len(set.Queries))
+	t.Logf("MRR %.3f, recall@%v %.3f", mrr, k, recall)
+
+	if mrr < 0.9 {
+		t.Errorf("MRR %.3f below 0.9", mrr)
+	}
+	if recall < 0.8 {
+		t.Errorf("recall@%v %.3f below 0.8", k, recall)
+	}
+}
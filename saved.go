@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	ansihighlighter "github.com/blevesearch/bleve/search/highlight/highlighter/ansi"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// SavedSearch is a named query, newly indexed docs matching it are reported to its hooks
+type SavedSearch struct {
+	Name      string
+	Query     string
+	Mode      string
+	Exec      string
+	Webhook   string
+	CreatedAt int64
+}
+
+// Hooks are notified when a new doc matches a saved search, Exec is run by sh with the alert
+// as json on stdin, Webhook receives the alert as json by POST
+type Hooks struct {
+	Exec    string `yaml:"exec"`
+	Webhook string `yaml:"webhook"`
+}
+
+// Alert is sent to hooks
+type Alert struct {
+	Search string
+	Query  string
+	Id     string
+	Title  string
+	Src    string
+}
+
+var hookclient = &http.Client{Timeout: 10 * time.Second}
+
+func put_saved(s *SavedSearch) error {
+	return db.Update(func(tx *Tx) error {
+		bs, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return tx.Put("saved", s.Name, bs)
+	})
+}
+
+// get_saved loads saved search by name, returns nil if not found
+func get_saved(name string) (*SavedSearch, error) {
+	var s *SavedSearch
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("saved", name)
+		if err != nil || v == nil {
+			return err
+		}
+		s = &SavedSearch{}
+		return json.Unmarshal(v, s)
+	})
+	return s, err
+}
+
+func list_saved() ([]*SavedSearch, error) {
+	searches := []*SavedSearch{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("saved", "", func(k string, v []byte) error {
+			s := &SavedSearch{}
+			if err := json.Unmarshal(v, s); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			searches = append(searches, s)
+			return nil
+		})
+	})
+	return searches, err
+}
+
+// del_saved removes saved search by name, reports whether it existed
+func del_saved(name string) (bool, error) {
+	found := false
+	err := db.Update(func(tx *Tx) error {
+		v, err := tx.Get("saved", name)
+		if err != nil {
+			return err
+		}
+		found = v != nil
+		return tx.Delete("saved", name)
+	})
+	return found, err
+}
+
+// saved_options are search options of saved search
+func saved_options(s *SavedSearch) *searchoptions {
+	return &searchoptions{
+		Keyword:   s.Query,
+		Mode:      s.Mode,
+		Fuzziness: conf.Fuzziness,
+		Boost:     conf.Boost,
+	}
+}
+
+// matching_saved returns saved searches doc matches
+func matching_saved(doc *Doc) ([]*SavedSearch, error) {
+	searches, err := list_saved()
+	if err != nil {
+		return nil, err
+	}
+	matched := []*SavedSearch{}
+	for _, s := range searches {
+		q, _, err := build_query(saved_options(s))
+		if err != nil {
+			logrus.Errorf("saved search %v: %v", s.Name, err)
+			continue
+		}
+		req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(q, bleve.NewDocIDQuery([]string{doc.Id})), 1, 0, false)
+		res, err := idx.Search(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.Total > 0 {
+			matched = append(matched, s)
+		}
+	}
+	return matched, nil
+}
+
+// alert_saved reports a newly indexed doc to hooks of saved searches it matches,
+// errors of hooks are logged so that ingestion goes on
+func alert_saved(doc *Doc) {
+	matched, err := matching_saved(doc)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, s := range matched {
+		logrus.Infof("%v matches saved search %v", doc.Title, s.Name)
+		alert := &Alert{Search: s.Name, Query: s.Query, Id: doc.Id, Title: doc.Title, Src: doc.Src}
+		hooks := conf.Hooks
+		if s.Exec != "" {
+			hooks.Exec = s.Exec
+		}
+		if s.Webhook != "" {
+			hooks.Webhook = s.Webhook
+		}
+		if err := run_hooks(hooks, alert); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+func run_hooks(hooks Hooks, alert *Alert) error {
+	bs, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	if hooks.Exec != "" {
+		cmd := exec.Command("sh", "-c", hooks.Exec)
+		cmd.Stdin = bytes.NewReader(bs)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"READENGINE_SEARCH="+alert.Search,
+			"READENGINE_ID="+alert.Id,
+			"READENGINE_TITLE="+alert.Title,
+			"READENGINE_SRC="+alert.Src,
+		)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("exec hook of %v: %v", alert.Search, err)
+		}
+	}
+	if hooks.Webhook != "" {
+		resp, err := hookclient.Post(hooks.Webhook, "application/json", bytes.NewReader(bs))
+		if err != nil {
+			return fmt.Errorf("webhook of %v: %v", alert.Search, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook of %v: %v", alert.Search, resp.Status)
+		}
+	}
+	return nil
+}
+
+func saved_add(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "add")
+	}
+	mode := c.String("mode")
+	if !valid_mode(mode) {
+		logrus.Errorf("unknown mode %v", mode)
+		return cli.ShowCommandHelp(c, "add")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	s := &SavedSearch{
+		Name:      c.Args().First(),
+		Query:     strings.Join(c.Args().Tail(), " "),
+		Mode:      mode,
+		Exec:      c.String("exec"),
+		Webhook:   c.String("webhook"),
+		CreatedAt: time.Now().Unix(),
+	}
+	if _, _, err := build_query(saved_options(s)); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if err := put_saved(s); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("saved search %v: %v", s.Name, s.Query)
+	return nil
+}
+
+func saved_list(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	searches, err := list_saved()
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	for _, s := range searches {
+		fmt.Printf("%v\t[%v] %v\n", s.Name, s.Mode, s.Query)
+	}
+	return nil
+}
+
+func saved_run(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "run")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	s, err := get_saved(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if s == nil {
+		logrus.Errorf("saved search %v not found", c.Args().First())
+		return nil
+	}
+
+	opts := saved_options(s)
+	opts.Limit = c.Int("limit")
+	opts.Sort = c.String("sort")
+	opts.Style = ansihighlighter.Name
+	if opts.Since, err = parse_date(c.String("since"), false); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	res, err := run_search(opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if res.Total > 0 {
+		logrus.Infof("找到 %v 条结果", res.Total)
+	} else {
+		logrus.Info("未找到结果")
+	}
+	print_table(res)
+	return nil
+}
+
+func saved_del(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "del")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	for _, name := range c.Args() {
+		found, err := del_saved(name)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		if found {
+			logrus.Infof("saved search %v deleted", name)
+		} else {
+			logrus.Errorf("saved search %v not found", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchingSaved(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, s := range []*SavedSearch{
+		{Name: "go", Query: "goroutine OR channel", Mode: ModeBool},
+		{Name: "bread", Query: "sourdough"},
+		{Name: "go-blog", Query: "goroutine site:blog.golang.org", Mode: ModeMatch},
+	} {
+		if err := put_saved(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := &Doc{Id: "1514764800", Src: "https://medium.com/x", Title: "Go pipelines", Content: "Each stage is a goroutine."}
+	if err := save_doc(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	matched, err := matching_saved(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Name != "go" {
+		t.Errorf("expect only saved search go, got %v", matched)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	received := &Alert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(received)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "readengine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "alert")
+
+	alert := &Alert{Search: "go", Query: "goroutine", Id: "1514764800", Title: "Go pipelines", Src: "https://medium.com/x"}
+	if err := run_hooks(Hooks{Exec: `echo "$READENGINE_TITLE" > ` + out, Webhook: server.URL}, alert); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(out); err != nil || string(content) != "Go pipelines\n" {
+		t.Errorf("unexpected exec hook output %q %v", content, err)
+	}
+	if *received != *alert {
+		t.Errorf("unexpected webhook alert %+v", received)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	bsearch "github.com/blevesearch/bleve/search"
+	ansihighlighter "github.com/blevesearch/bleve/search/highlight/highlighter/ansi"
+	htmlhighlighter "github.com/blevesearch/bleve/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/sillydong/goczd/gotime"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// text fields matched by keyword
+var searchfields = []string{"zh.Title", "en.Title", "cjk.Title", "zh.Headings", "en.Headings", "cjk.Headings", "zh.Content", "en.Content", "cjk.Content", "Note", "Highlights", "HighlightNotes"}
+
+// fields loaded for each hit
+var resultfields = []string{"Src", "Title", "Author", "Status", "Tags"}
+
+type searchoptions struct {
+	Keyword string
+	Raw     bool
+	Status  string
+	Site    string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+	Sort    string
+	Style   string
+	Boost   Boost
+	//search mode and edit distance of fuzzy mode
+	Mode      string
+	Fuzziness int
+	//count results by facetfields
+	Facets    bool
+	FacetSize int
+}
+
+func search(c *cli.Context) error {
+	if c.NArg() == 0 && c.String("site") == "" && c.String("since") == "" && c.String("until") == "" {
+		return cli.ShowCommandHelp(c, "search")
+	}
+
+	format := c.String("format")
+	if format != "table" && format != "json" && format != "ids" {
+		logrus.Errorf("unknown format %v", format)
+		return cli.ShowCommandHelp(c, "search")
+	}
+
+	init_engine(c)
+	defer close_engine()
+
+	opts := &searchoptions{
+		Keyword: strings.Join(c.Args(), " "),
+		Raw:     c.Bool("raw"),
+		Status:  c.String("status"),
+		Site:    c.String("site"),
+		Limit:   c.Int("limit"),
+		Offset:  c.Int("offset"),
+		Sort:    c.String("sort"),
+		Boost:   conf.Boost,
+		Mode:    c.String("mode"),
+		Facets:  c.Bool("facets"),
+	}
+	opts.FacetSize = c.Int("facet-size")
+	if !valid_mode(opts.Mode) {
+		logrus.Errorf("unknown mode %v", opts.Mode)
+		return cli.ShowCommandHelp(c, "search")
+	}
+	opts.Fuzziness = conf.Fuzziness
+	if c.IsSet("fuzziness") {
+		opts.Fuzziness = c.Int("fuzziness")
+	}
+	for _, b := range c.StringSlice("boost") {
+		if err := set_boost(&opts.Boost, b); err != nil {
+			logrus.Error(err)
+			return err
+		}
+	}
+	var err error
+	if opts.Since, err = parse_date(c.String("since"), false); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if opts.Until, err = parse_date(c.String("until"), true); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	switch format {
+	case "table":
+		opts.Style = ansihighlighter.Name
+	case "json":
+		opts.Style = htmlhighlighter.Name
+	}
+
+	res, err := run_search(opts)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if err := record_query(opts.Keyword); err != nil {
+		logrus.Error(err)
+	}
+
+	if res.Total > 0 {
+		logrus.Infof("找到 %v 条结果", res.Total)
+	} else {
+		logrus.Info("未找到结果")
+	}
+
+	switch format {
+	case "json":
+		return print_json(res)
+	case "ids":
+		for _, hit := range res.Hits {
+			fmt.Println(hit.ID)
+		}
+	default:
+		print_table(res)
+		if opts.Facets {
+			fmt.Println()
+			print_facets(facet_results(res))
+		}
+	}
+	return nil
+}
+
+// run_search searches index with options, hits are reranked by recency when the boost is on
+func run_search(opts *searchoptions) (*bleve.SearchResult, error) {
+	req, err := new_search_request(opts)
+	if err != nil {
+		return nil, err
+	}
+	rerank := opts.Boost.Recency > 0 && (opts.Sort == "" || opts.Sort == "score")
+	from, size := req.From, req.Size
+	if rerank {
+		//rerank the top hits then take the page out of them
+		req.From = 0
+		req.Size = from + size
+		if req.Size < rerankwindow {
+			req.Size = rerankwindow
+		}
+	}
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if rerank {
+		published, err := published_dates(res.Hits)
+		if err != nil {
+			return nil, err
+		}
+		recency_rerank(res.Hits, published, time.Now(), opts.Boost)
+		if len(res.Hits) > 0 {
+			res.MaxScore = res.Hits[0].Score
+		}
+		if from > len(res.Hits) {
+			from = len(res.Hits)
+		}
+		if from+size > len(res.Hits) {
+			size = len(res.Hits) - from
+		}
+		res.Hits = res.Hits[from : from+size]
+	}
+	return res, nil
+}
+
+// new_search_request builds search request from options
+func new_search_request(opts *searchoptions) (*bleve.SearchRequest, error) {
+	q, haskeyword, err := build_query(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	req := bleve.NewSearchRequestOptions(q, limit, opts.Offset, false)
+	req.Fields = resultfields
+	if opts.Style != "" && haskeyword {
+		req.Highlight = bleve.NewHighlightWithStyle(opts.Style)
+		req.Highlight.Fields = searchfields
+	}
+
+	if opts.Facets {
+		if err := add_facets(req, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	switch opts.Sort {
+	case "", "score":
+	case "date":
+		req.SortBy([]string{"-Added", "-_score"})
+	default:
+		return nil, fmt.Errorf("unknown sort %v", opts.Sort)
+	}
+	return req, nil
+}
+
+// build_query combines keyword with filters, reports whether there is a keyword to highlight
+func build_query(opts *searchoptions) (query.Query, bool, error) {
+	keyword, filters := opts.Keyword, []query.Query{}
+	if !opts.Raw {
+		keyword, filters = split_filters(opts.Keyword)
+	}
+
+	var q query.Query
+	var err error
+	switch {
+	case keyword == "":
+		q = bleve.NewMatchAllQuery()
+	case opts.Raw:
+		q = bleve.NewQueryStringQuery(keyword)
+	default:
+		if q, err = mode_query(keyword, opts); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if opts.Status != "" {
+		statusquery := bleve.NewTermQuery(opts.Status)
+		statusquery.SetField("Status")
+		filters = append(filters, statusquery)
+	}
+	if opts.Site != "" {
+		sitequery := bleve.NewTermQuery(site_domain(opts.Site))
+		sitequery.SetField("Domain")
+		filters = append(filters, sitequery)
+	}
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		datequery := bleve.NewDateRangeQuery(opts.Since, opts.Until)
+		datequery.SetField("Added")
+		filters = append(filters, datequery)
+	}
+
+	if len(filters) > 0 {
+		q = bleve.NewConjunctionQuery(append([]query.Query{q}, filters...)...)
+	}
+	return q, keyword != "", nil
+}
+
+// site_domain normalizes a site given as domain or url to the indexed domain
+func site_domain(site string) string {
+	site = strings.ToLower(strings.TrimSpace(site))
+	if strings.Contains(site, "://") {
+		if u, err := url.Parse(site); err == nil {
+			site = u.Host
+		}
+	}
+	if pos := strings.Index(site, ":"); pos >= 0 {
+		site = site[:pos]
+	}
+	return strings.TrimPrefix(site, "www.")
+}
+
+// doc_domain returns domain of doc source
+func doc_domain(doc *Doc) string {
+	u, err := url.Parse(doc.Src)
+	if err != nil {
+		return ""
+	}
+	return site_domain(u.Host)
+}
+
+// doc_added returns the time doc was added, which is its id
+func doc_added(doc *Doc) time.Time {
+	addtime, err := strconv.ParseInt(doc.Id, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(addtime, 0)
+}
+
+// unix_time returns unix seconds of t, 0 for the zero time
+func unix_time(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// parse_date accepts dates like 2006-01-02, 2006-01-02 15:04:05 or relative days like 7d,
+// a date without time ends at the end of the day when end is true
+func parse_date(s string, end bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(gotime.FORMAT_YYYY_MM_DD_HH_II_SS, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", s)
+}
+
+func print_table(res *bleve.SearchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, hit := range res.Hits {
+		addtime, _ := strconv.Atoi(hit.ID)
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v %v%v\n", hit.ID, gotime.TimeToStr(int64(addtime), gotime.FORMAT_YYYY_MM_DD_HH_II_SS), hit.Fields["Title"], hit.Fields["Src"], status_label(hit.Fields["Status"]), tags_label(hit.Fields["Tags"]))
+		for _, fragment := range hit_fragments(hit) {
+			fmt.Fprintf(w, "\t\t\t%v\n", strings.Replace(fragment, "\n", " ", -1))
+		}
+	}
+	w.Flush()
+}
+
+type searchresult struct {
+	Total  uint64
+	Hits   []searchhit
+	Facets []facetresult `json:",omitempty"`
+}
+
+type searchhit struct {
+	Id        string
+	Score     float64
+	Added     string
+	Title     interface{}
+	Author    interface{}
+	Src       interface{}
+	Status    interface{}
+	Tags      interface{}
+	Fragments []string
+}
+
+func search_result(res *bleve.SearchResult) *searchresult {
+	result := &searchresult{Total: res.Total, Hits: []searchhit{}}
+	if len(res.Facets) > 0 {
+		result.Facets = facet_results(res)
+	}
+	for _, hit := range res.Hits {
+		addtime, _ := strconv.Atoi(hit.ID)
+		result.Hits = append(result.Hits, searchhit{
+			Id:        hit.ID,
+			Score:     hit.Score,
+			Added:     time.Unix(int64(addtime), 0).Format(time.RFC3339),
+			Title:     hit.Fields["Title"],
+			Author:    hit.Fields["Author"],
+			Src:       hit.Fields["Src"],
+			Status:    hit.Fields["Status"],
+			Tags:      hit.Fields["Tags"],
+			Fragments: hit_fragments(hit),
+		})
+	}
+	return result
+}
+
+func print_json(res *bleve.SearchResult) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(search_result(res))
+}
+
+// hit_fragments returns highlighted fragments of hit in the order of searchfields
+func hit_fragments(hit *bsearch.DocumentMatch) []string {
+	fragments := []string{}
+	for _, field := range searchfields {
+		for _, fragment := range hit.Fragments[field] {
+			if strings.TrimSpace(fragment) != "" {
+				fragments = append(fragments, fragment)
+			}
+		}
+	}
+	return fragments
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	since, err := parse_date("2018-01-02", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if since.Format("2006-01-02 15:04:05") != "2018-01-02 00:00:00" {
+		t.Errorf("unexpected since %v", since)
+	}
+	until, err := parse_date("2018-01-02", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until.Format("2006-01-02 15:04:05") != "2018-01-02 23:59:59" {
+		t.Errorf("unexpected until %v", until)
+	}
+	week, err := parse_date("7d", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(week); d < 7*24*time.Hour-time.Minute || d > 7*24*time.Hour+time.Minute {
+		t.Errorf("unexpected relative date %v", week)
+	}
+	if _, err := parse_date("yesterday", false); err == nil {
+		t.Error("expect error for invalid date")
+	}
+}
+
+func TestSiteDomain(t *testing.T) {
+	for in, expect := range map[string]string{
+		"medium.com":                     "medium.com",
+		"https://www.Medium.com/@x/post": "medium.com",
+		"localhost:8080":                 "localhost",
+	} {
+		if domain := site_domain(in); domain != expect {
+			t.Errorf("%v: expect %v, got %v", in, expect, domain)
+		}
+	}
+}
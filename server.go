@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	htmlhighlighter "github.com/blevesearch/bleve/search/highlight/highlighter/html"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func serve(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	addr := c.String("addr")
+	logrus.Infof("listening on %v", addr)
+	if err := http.ListenAndServe(addr, new_mux()); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+// new_mux routes the api, shared by serve and daemon
+func new_mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/docs/", api_docs)
+	mux.HandleFunc("/api/highlights/", api_highlights)
+	mux.HandleFunc("/api/search", api_search)
+	mux.HandleFunc("/api/suggest", api_suggest)
+	mux.HandleFunc("/api/jobs", api_jobs)
+	mux.HandleFunc("/api/jobs/new", api_new_jobs)
+	mux.HandleFunc("/feed.atom", serve_feed(FormatAtom))
+	mux.HandleFunc("/feed.rss", serve_feed(FormatRSS))
+	mux.HandleFunc("/subscriptions.opml", serve_opml)
+	return mux
+}
+
+// api_docs serves
+//
+//	GET  /api/docs/{id}
+//	GET  /api/docs/{id}/highlights
+//	GET  /api/docs/{id}/related?limit=10
+//	POST /api/docs/{id}/highlights
+//	PUT  /api/docs/{id}/state
+func api_docs(w http.ResponseWriter, r *http.Request) {
+	parts := path_parts(r.URL.Path, "/api/docs/")
+	if len(parts) == 0 {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	doc, err := get_doc(parts[0])
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if doc == nil {
+		write_error(w, http.StatusNotFound, "doc not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		write_json(w, http.StatusOK, doc)
+	case len(parts) == 2 && parts[1] == "highlights" && r.Method == http.MethodGet:
+		highlights, err := list_highlights(doc.Id)
+		if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusOK, highlights)
+	case len(parts) == 2 && parts[1] == "related" && r.Method == http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		res, err := related_docs(doc, limit)
+		if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusOK, search_result(res))
+	case len(parts) == 2 && parts[1] == "highlights" && r.Method == http.MethodPost:
+		req := Highlight{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			write_error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h, err := add_highlight(doc, req.Exact, req.Prefix, req.Suffix, req.Note)
+		if err == ErrQuoteNotFound {
+			write_error(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusCreated, h)
+	case len(parts) == 2 && parts[1] == "state" && r.Method == http.MethodPut:
+		req := struct {
+			State    string
+			Progress *float64
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			write_error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.State != "" {
+			if err := set_state(doc, req.State); err != nil {
+				write_error(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if req.Progress != nil {
+			if err := set_progress(doc, *req.Progress); err != nil {
+				write_error(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if err := save_doc(doc); err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		write_json(w, http.StatusOK, doc)
+	default:
+		write_error(w, http.StatusNotFound, "not found")
+	}
+}
+
+// api_highlights serves
+//
+//	DELETE /api/highlights/{id}
+func api_highlights(w http.ResponseWriter, r *http.Request) {
+	parts := path_parts(r.URL.Path, "/api/highlights/")
+	if len(parts) != 1 || r.Method != http.MethodDelete {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	h, err := remove_highlight(parts[0])
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if h == nil {
+		write_error(w, http.StatusNotFound, "highlight not found")
+		return
+	}
+	write_json(w, http.StatusOK, h)
+}
+
+// api_search serves
+//
+//	GET /api/search?q=keyword&mode=fuzzy&fuzziness=1&limit=10&offset=0&sort=score&site=&since=&until=&status=&facets=1
+func api_search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	params := r.URL.Query()
+	opts := &searchoptions{
+		Keyword:   params.Get("q"),
+		Status:    params.Get("status"),
+		Site:      params.Get("site"),
+		Sort:      params.Get("sort"),
+		Style:     htmlhighlighter.Name,
+		Boost:     conf.Boost,
+		Mode:      params.Get("mode"),
+		Fuzziness: conf.Fuzziness,
+		Facets:    params.Get("facets") != "" && params.Get("facets") != "0" && params.Get("facets") != "false",
+	}
+	if opts.Mode != "" && !valid_mode(opts.Mode) {
+		write_error(w, http.StatusBadRequest, "unknown mode "+opts.Mode)
+		return
+	}
+	var err error
+	for name, value := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset, "fuzziness": &opts.Fuzziness, "facet_size": &opts.FacetSize} {
+		if params.Get(name) == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(params.Get(name)); err != nil {
+			write_error(w, http.StatusBadRequest, "invalid "+name)
+			return
+		}
+	}
+	if opts.Since, err = parse_date(params.Get("since"), false); err != nil {
+		write_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.Until, err = parse_date(params.Get("until"), true); err != nil {
+		write_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := run_search(opts)
+	if err != nil {
+		write_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := record_query(opts.Keyword); err != nil {
+		logrus.Error(err)
+	}
+	write_json(w, http.StatusOK, search_result(res))
+}
+
+// api_suggest serves
+//
+//	GET /api/suggest?q=partial&limit=10
+func api_suggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	suggestions, err := complete(r.URL.Query().Get("q"), limit)
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	write_json(w, http.StatusOK, suggestions)
+}
+
+// most docs a published feed carries
+const maxfeedlimit = 100
+
+// serve_feed serves recently indexed docs as feed of format
+//
+//	GET /feed.atom?tag=&collection=&saved=&limit=20&title=
+//	GET /feed.rss?tag=&collection=&saved=&limit=20&title=
+func serve_feed(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			write_error(w, http.StatusNotFound, "not found")
+			return
+		}
+		params := r.URL.Query()
+		opts := &publishoptions{
+			Format:     format,
+			Tag:        params.Get("tag"),
+			Collection: params.Get("collection"),
+			Saved:      params.Get("saved"),
+			Title:      params.Get("title"),
+			Link:       request_url(r),
+		}
+		if limit := params.Get("limit"); limit != "" {
+			var err error
+			if opts.Limit, err = strconv.Atoi(limit); err != nil {
+				write_error(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+		}
+		if opts.Limit > maxfeedlimit {
+			opts.Limit = maxfeedlimit
+		}
+		docs, err := published_docs(opts)
+		if err != nil {
+			write_error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bs, err := render_feed(docs, opts)
+		if err != nil {
+			write_error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", feed_content_type(format))
+		w.Write(bs)
+	}
+}
+
+// serve_opml serves feed subscriptions
+//
+//	GET /subscriptions.opml
+func serve_opml(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		write_error(w, http.StatusNotFound, "not found")
+		return
+	}
+	subs, err := list_feeds()
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	bs, err := export_opml(subs)
+	if err != nil {
+		write_error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Write(bs)
+}
+
+// request_url is the absolute url of r as seen by the client
+func request_url(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// path_parts splits the url path after prefix
+func path_parts(urlpath string, prefix string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(strings.TrimPrefix(urlpath, prefix), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func write_json(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Error(err)
+	}
+}
+
+func write_error(w http.ResponseWriter, code int, msg string) {
+	write_json(w, code, map[string]string{"error": msg})
+}
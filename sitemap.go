@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// nested sitemap indexes are followed this deep
+const sitemapdepth = 3
+
+// sitemap_urls lists pages of sitemap src, sitemaps listed by a sitemap index are fetched in turn
+func sitemap_urls(src string) ([]extractor.SitemapEntry, error) {
+	entries := []extractor.SitemapEntry{}
+	seen := map[string]bool{}
+	var walk func(src string, depth int) error
+	walk = func(src string, depth int) error {
+		if seen[src] {
+			return nil
+		}
+		seen[src] = true
+		sitemap, err := extractor.FetchSitemap(src)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, sitemap.URLs...)
+		if depth >= sitemapdepth {
+			return nil
+		}
+		for _, child := range sitemap.Sitemaps {
+			//a broken child sitemap should not lose the others
+			if err := walk(child.Loc, depth+1); err != nil {
+				logrus.Errorf("sitemap %v: %v", child.Loc, err)
+			}
+		}
+		return nil
+	}
+	if err := walk(src, 0); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// sitemapfilter picks sitemap entries by lastmod and url
+type sitemapfilter struct {
+	since   time.Time
+	until   time.Time
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// allows reports whether entry passes the filter, entries without lastmod fail a date range
+func (f *sitemapfilter) allows(entry extractor.SitemapEntry) bool {
+	if !f.since.IsZero() || !f.until.IsZero() {
+		if entry.LastMod.IsZero() {
+			return false
+		}
+		if !f.since.IsZero() && entry.LastMod.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && entry.LastMod.After(f.until) {
+			return false
+		}
+	}
+	return match_urls(entry.Loc, f.include, f.exclude)
+}
+
+// sitemap_src is src itself, or /sitemap.xml of the site when src has no path
+func sitemap_src(src string) (string, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%v is not a http url", src)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/sitemap.xml"
+	}
+	return u.String(), nil
+}
+
+func sitemap(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "sitemap")
+	}
+	filter := &sitemapfilter{}
+	var err error
+	if filter.since, err = parse_date(c.String("since"), false); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if filter.until, err = parse_date(c.String("until"), true); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if filter.include, err = compile_regexps(c.StringSlice("include")); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if filter.exclude, err = compile_regexps(c.StringSlice("exclude")); err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	load_conf()
+	urls := []string{}
+	seen := map[string]bool{}
+	for _, arg := range c.Args() {
+		src, err := sitemap_src(arg)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		entries, err := sitemap_urls(src)
+		if err != nil {
+			logrus.Errorf("sitemap %v: %v", src, err)
+			return err
+		}
+		matched := 0
+		for _, entry := range entries {
+			if !seen[entry.Loc] && filter.allows(entry) {
+				seen[entry.Loc] = true
+				urls = append(urls, entry.Loc)
+				matched++
+			}
+		}
+		logrus.Infof("%v: %v of %v urls matched", src, matched, len(entries))
+	}
+
+	if c.Bool("dry-run") {
+		for _, u := range urls {
+			fmt.Println(u)
+		}
+		return nil
+	}
+	if len(urls) == 0 {
+		logrus.Info("未找到数据")
+		return nil
+	}
+	jobs, err := queue_new_urls(c, urls)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	for _, job := range jobs {
+		logrus.Infof("queued job %v: %v", job.Id, job.Url)
+	}
+	logrus.Infof("queued %v urls, %v already in the store or the queue", len(jobs), len(urls)-len(jobs))
+	return nil
+}
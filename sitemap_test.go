@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sillydong/readengine/extractor"
+)
+
+func TestSitemapFilter(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	filter := &sitemapfilter{
+		since:   day("2018-03-01"),
+		until:   day("2018-04-01"),
+		include: []*regexp.Regexp{regexp.MustCompile(`/posts/`)},
+		exclude: []*regexp.Regexp{regexp.MustCompile(`/draft`)},
+	}
+	for _, c := range []struct {
+		entry  extractor.SitemapEntry
+		expect bool
+	}{
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/posts/a", LastMod: day("2018-03-10")}, true},
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/posts/a", LastMod: day("2018-02-10")}, false},
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/posts/a", LastMod: day("2018-04-10")}, false},
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/posts/a"}, false},
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/about", LastMod: day("2018-03-10")}, false},
+		{extractor.SitemapEntry{Loc: "https://blog.example.com/posts/draft-b", LastMod: day("2018-03-10")}, false},
+	} {
+		if got := filter.allows(c.entry); got != c.expect {
+			t.Errorf("%+v: expect %v, got %v", c.entry, c.expect, got)
+		}
+	}
+	if !(&sitemapfilter{}).allows(extractor.SitemapEntry{Loc: "https://blog.example.com/about"}) {
+		t.Error("expect empty filter to allow everything")
+	}
+
+	for src, expect := range map[string]string{
+		"https://blog.example.com":                  "https://blog.example.com/sitemap.xml",
+		"https://blog.example.com/":                 "https://blog.example.com/sitemap.xml",
+		"https://blog.example.com/post-sitemap.xml": "https://blog.example.com/post-sitemap.xml",
+	} {
+		if got, err := sitemap_src(src); err != nil || got != expect {
+			t.Errorf("%v: expect %v, got %v %v", src, expect, got, err)
+		}
+	}
+	if _, err := sitemap_src("blog.example.com"); err == nil {
+		t.Error("expect error without scheme")
+	}
+}
+
+func TestQueueNewJobs(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+
+	if err := put_doc(&Doc{Id: "1", Src: "https://blog.example.com/posts/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue_job("https://blog.example.com/posts/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	//queued through the api like readengine sitemap does while the daemon runs
+	api := httptest.NewServer(new_mux())
+	defer api.Close()
+	jobs, err := post_new_jobs(api.Listener.Addr().String(), []string{
+		"https://blog.example.com/posts/a",
+		"https://blog.example.com/posts/b",
+		"https://blog.example.com/posts/c",
+		"https://blog.example.com/posts/c",
+	})
+	if err != nil || len(jobs) != 1 || jobs[0].Url != "https://blog.example.com/posts/c" {
+		t.Fatalf("expect only c queued, got %+v %v", jobs, err)
+	}
+	if jobs, err := queue_new_jobs([]string{"https://blog.example.com/posts/c", "https://blog.example.com/posts/d"}); err != nil || len(jobs) != 1 {
+		t.Errorf("expect only d queued, got %+v %v", jobs, err)
+	}
+	if pending, _ := list_jobs(JobPending); len(pending) != 3 {
+		t.Errorf("expect 3 pending jobs, got %+v", pending)
+	}
+}
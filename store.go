@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//get_doc loads doc by id from db, returns nil if not found
+func get_doc(id string) (*Doc, error) {
+	var doc *Doc
+	err := db.View(func(tx *Tx) error {
+		v, err := tx.Get("readengine", id)
+		if err != nil || v == nil {
+			return err
+		}
+		doc = &Doc{}
+		return json.Unmarshal(v, doc)
+	})
+	return doc, err
+}
+
+//put_doc saves doc into db and stamps its modified time
+func put_doc(doc *Doc) error {
+	doc.ModifiedAt = time.Now().UnixNano()
+	return db.Update(func(tx *Tx) error {
+		docbytes, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return tx.Put("readengine", doc.Id, docbytes)
+	})
+}
+
+//save_doc saves doc into db and updates its index
+func save_doc(doc *Doc) error {
+	if err := put_doc(doc); err != nil {
+		return err
+	}
+	return index_doc(doc)
+}
+
+//delete_doc removes doc of id with its highlights from db and index, returns false if db has no doc of id.
+//The index is changed last inside the db transaction so that its failure leaves db unchanged,
+//and the doc is indexed again if db fails to commit after that.
+func delete_doc(id string) (bool, error) {
+	found, unindexed := false, false
+	err := db.Update(func(tx *Tx) error {
+		v, err := tx.Get("readengine", id)
+		if err != nil {
+			return err
+		}
+		if found = v != nil; found {
+			if err := tx.Delete("readengine", id); err != nil {
+				return err
+			}
+		}
+		keys := []string{}
+		err = tx.Iterate("highlights", id+"-", func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete("highlights", k); err != nil {
+				return err
+			}
+		}
+		if err := idx.Delete(id); err != nil {
+			return err
+		}
+		unindexed = true
+		return nil
+	})
+	if err != nil && unindexed && found {
+		if doc, gerr := get_doc(id); gerr == nil && doc != nil {
+			if ierr := index_doc(doc); ierr != nil {
+				logrus.Errorf("reindexing %v: %v", id, ierr)
+			}
+		}
+	}
+	return found, err
+}
+
+//indexdoc is what gets indexed for a doc, Doc fields plus data stored aside
+type indexdoc struct {
+	Doc
+	Zh             *langtext `json:"zh,omitempty"`
+	En             *langtext `json:"en,omitempty"`
+	Cjk            *langtext `json:"cjk,omitempty"`
+	Added          time.Time
+	Domain         string
+	Suggest        string
+	Highlights     []string
+	HighlightNotes []string
+}
+
+//index_doc indexes doc together with its highlights
+func index_doc(doc *Doc) error {
+	data, err := index_data(doc)
+	if err != nil {
+		return err
+	}
+	return idx.Index(doc.Id, data)
+}
+
+//index_data is what gets indexed for doc
+func index_data(doc *Doc) (*indexdoc, error) {
+	highlights, err := list_highlights(doc.Id)
+	if err != nil {
+		return nil, err
+	}
+	data := indexdoc{Doc: *doc}
+	data.ReadState = read_state(doc)
+	data.ReadingTime = doc_reading_time(doc)
+	data.Language = doc_language(doc)
+	text := &langtext{Title: doc.Title, Headings: doc.Headings, Content: doc.Content}
+	switch lang_field(data.Language) {
+	case "en":
+		data.En = text
+	case "cjk":
+		data.Cjk = text
+	default:
+		data.Zh = text
+	}
+	data.Added = doc_added(doc)
+	data.Domain = doc_domain(doc)
+	data.Suggest = doc.Title
+	for _, h := range highlights {
+		data.Highlights = append(data.Highlights, h.Exact)
+		if h.Note != "" {
+			data.HighlightNotes = append(data.HighlightNotes, h.Note)
+		}
+	}
+	return &data, nil
+}
+
+//doc_ids lists ids of all docs in db
+func doc_ids() ([]string, error) {
+	ids := []string{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("readengine", "", func(k string, v []byte) error {
+			ids = append(ids, k)
+			return nil
+		})
+	})
+	return ids, err
+}
+
+//stored_srcs maps src of all docs in db to their ids
+func stored_srcs() (map[string]string, error) {
+	srcs := map[string]string{}
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("readengine", "", func(k string, v []byte) error {
+			doc := &Doc{}
+			if err := json.Unmarshal(v, doc); err != nil {
+				return err
+			}
+			srcs[doc.Src] = k
+			return nil
+		})
+	})
+	return srcs, err
+}
+
+//src_doc_id returns id of the doc of src, empty if not found
+func src_doc_id(src string) (string, error) {
+	id := ""
+	err := db.View(func(tx *Tx) error {
+		ids, err := tx.Query("readengine", "src", src)
+		if err == nil && len(ids) > 0 {
+			id = ids[0]
+		}
+		return err
+	})
+	return id, err
+}
+
+//ids handed out by new_doc_id, so that docs ingested at once by workers and schedules
+//of the daemon get distinct ids before they are saved
+var (
+	docidlock sync.Mutex
+	lastdocid int64
+)
+
+//new_doc_id returns the current unix time as id, later seconds are taken when it is used
+//so that docs ingested in a batch keep distinct ids
+func new_doc_id() (string, error) {
+	docidlock.Lock()
+	defer docidlock.Unlock()
+	now := time.Now().Unix()
+	if now <= lastdocid {
+		now = lastdocid + 1
+	}
+	id := ""
+	err := db.View(func(tx *Tx) error {
+		for ; ; now++ {
+			id = strconv.FormatInt(now, 10)
+			if v, err := tx.Get("readengine", id); err != nil || v == nil {
+				return err
+			}
+		}
+	})
+	if err == nil {
+		lastdocid = now
+	}
+	return id, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// fields whose terms are suggested, Suggest holds the title segmented but not stemmed
+var suggestfields = []string{"Suggest", "Tags", "Keywords"}
+
+// sources of suggestions
+const (
+	SourceQuery = "query"
+	SourceTerm  = "term"
+)
+
+// Suggestion is a completion of what user is typing, Count is how many times the query
+// was searched or how many docs contain the term
+type Suggestion struct {
+	Text   string
+	Count  uint64
+	Source string
+}
+
+// searchedquery is a previous query kept in the queries bucket keyed by normalized query
+type searchedquery struct {
+	Count  uint64
+	LastAt int64
+}
+
+func normalize_query(keyword string) string {
+	return strings.Join(strings.Fields(strings.ToLower(keyword)), " ")
+}
+
+// record_query counts keyword as searched
+func record_query(keyword string) error {
+	keyword = normalize_query(keyword)
+	if keyword == "" {
+		return nil
+	}
+	return db.Update(func(tx *Tx) error {
+		q := searchedquery{}
+		v, err := tx.Get("queries", keyword)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+		}
+		q.Count++
+		q.LastAt = time.Now().Unix()
+		bs, err := json.Marshal(q)
+		if err != nil {
+			return err
+		}
+		return tx.Put("queries", keyword, bs)
+	})
+}
+
+// complete completes input from previous queries starting with it and from indexed terms
+// starting with its last word, ranked by frequency
+func complete(input string, limit int) ([]Suggestion, error) {
+	//a trailing space means the last word is finished
+	finished := strings.HasSuffix(input, " ")
+	input = normalize_query(input)
+	if limit <= 0 {
+		limit = 10
+	}
+	counts := map[string]uint64{}
+	sources := map[string]string{}
+
+	err := db.View(func(tx *Tx) error {
+		return tx.Iterate("queries", input, func(k string, v []byte) error {
+			q := searchedquery{}
+			if err := json.Unmarshal(v, &q); err != nil {
+				logrus.Error(err)
+				return nil
+			}
+			counts[k] += q.Count
+			sources[k] = SourceQuery
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//complete the last word with indexed terms, words before it are kept
+	if input != "" && !finished {
+		head, word := "", input
+		if pos := strings.LastIndex(input, " "); pos >= 0 {
+			head, word = input[:pos+1], input[pos+1:]
+		}
+		for _, field := range suggestfields {
+			dict, err := idx.FieldDictPrefix(field, []byte(word))
+			if err != nil {
+				return nil, err
+			}
+			for entry, err := dict.Next(); entry != nil && err == nil; entry, err = dict.Next() {
+				if entry.Term == word {
+					continue
+				}
+				text := head + entry.Term
+				counts[text] += entry.Count
+				if sources[text] == "" {
+					sources[text] = SourceTerm
+				}
+			}
+			dict.Close()
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for text, count := range counts {
+		suggestions = append(suggestions, Suggestion{Text: text, Count: count, Source: sources[text]})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+func suggest(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	suggestions, err := complete(strings.Join(c.Args(), " "), c.Int("limit"))
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	for _, s := range suggestions {
+		fmt.Printf("%v\t%v\t%v\n", s.Text, s.Count, s.Source)
+	}
+	return nil
+}
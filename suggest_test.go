@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	closer := open_test_engine(t)
+	defer closer()
+	for _, doc := range []*Doc{
+		{Id: "1514764800", Title: "Go pipelines", Tags: []string{"golang"}},
+		{Id: "1517443200", Title: "Pipelines in production", Tags: []string{"golang"}},
+		{Id: "1519862400", Title: "并发 编程 指南"},
+	} {
+		if err := save_doc(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{"go pipelines", "Go  Pipelines", "go channels"} {
+		if err := record_query(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range []struct {
+		Input  string
+		Expect []string
+	}{
+		//previous queries first by count, then terms completing the last word
+		{"go", []string{"go pipelines", "golang", "go channels"}},
+		{"go pi", []string{"go pipelines"}},
+		{"并", []string{"并发"}},
+		{"go ", []string{"go pipelines", "go channels"}},
+	} {
+		suggestions, err := complete(c.Input, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts := []string{}
+		for _, s := range suggestions {
+			texts = append(texts, s.Text)
+		}
+		if len(texts) != len(c.Expect) {
+			t.Errorf("%q: expect %v, got %v", c.Input, c.Expect, texts)
+			continue
+		}
+		for i := range texts {
+			if texts[i] != c.Expect[i] {
+				t.Errorf("%q: expect %v, got %v", c.Input, c.Expect, texts)
+				break
+			}
+		}
+	}
+}
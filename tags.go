@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// filter prefixes usable in search keyword and the fields they match
+var filterfields = map[string]string{
+	"tag":        "Tags",
+	"collection": "Collection",
+	"status":     "Status",
+	"state":      "ReadState",
+	"lang":       "Language",
+	"keyword":    "Keywords",
+	"author":     "Author",
+	"feed":       "Feed",
+}
+
+// split_filters separates filters like tag:go or collection:k8s from the keyword,
+// values with spaces are quoted like author:"Rob Pike", words inside "quoted phrases" are never filters
+func split_filters(input string) (string, []query.Query) {
+	words := []string{}
+	filters := []query.Query{}
+	inquote := false
+	fields := strings.Fields(input)
+	for i := 0; i < len(fields); i++ {
+		word := fields[i]
+		pos := strings.Index(word, ":")
+		if !inquote && pos > 0 && pos < len(word)-1 {
+			prefix, value := strings.ToLower(word[:pos]), word[pos+1:]
+			end := i
+			if strings.HasPrefix(value, "\"") {
+				//join the words of a quoted value
+				for ; end < len(fields)-1 && !quote_closed(value); end++ {
+					value += " " + fields[end+1]
+				}
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				} else {
+					value = strings.Trim(value, "\"")
+				}
+			}
+			if q := filter_query(prefix, value); q != nil {
+				filters = append(filters, q)
+				i = end
+				continue
+			}
+		}
+		words = append(words, word)
+		if (strings.Count(word, "\"")-strings.Count(word, "\\\""))%2 == 1 {
+			inquote = !inquote
+		}
+	}
+	return strings.Join(words, " "), filters
+}
+
+// quote_closed reports whether value starting with a quote ends with an unescaped quote
+func quote_closed(value string) bool {
+	return len(value) > 1 && strings.HasSuffix(value, "\"") && !strings.HasSuffix(value, "\\\"")
+}
+
+// filter_query returns query of filter prefix:value, nil if prefix is not a filter
+func filter_query(prefix, value string) query.Query {
+	if field, ok := filterfields[prefix]; ok {
+		if field == "Tags" || field == "Keywords" {
+			value = normalize_tag(value)
+		}
+		q := bleve.NewTermQuery(value)
+		q.SetField(field)
+		return q
+	}
+	switch prefix {
+	case "starred":
+		q := bleve.NewBoolFieldQuery(value == "true")
+		q.SetField("Starred")
+		return q
+	case "site":
+		q := bleve.NewTermQuery(site_domain(value))
+		q.SetField("Domain")
+		return q
+	case "month":
+		if q, err := month_query(value); err == nil {
+			return q
+		}
+	}
+	return nil
+}
+
+func tag_add(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "add")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	return update_doc(c.Args().First(), func(doc *Doc) error {
+		for _, tag := range c.Args().Tail() {
+			if tag = normalize_tag(tag); tag != "" && !has_tag(doc, tag) {
+				doc.Tags = append(doc.Tags, tag)
+			}
+		}
+		logrus.Infof("tags of %v: %v", doc.Id, strings.Join(doc.Tags, ", "))
+		return nil
+	})
+}
+
+func tag_remove(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return cli.ShowCommandHelp(c, "remove")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	return update_doc(c.Args().First(), func(doc *Doc) error {
+		remove := map[string]bool{}
+		for _, tag := range c.Args().Tail() {
+			remove[normalize_tag(tag)] = true
+		}
+		tags := []string{}
+		for _, tag := range doc.Tags {
+			if !remove[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		doc.Tags = tags
+		logrus.Infof("tags of %v: %v", doc.Id, strings.Join(doc.Tags, ", "))
+		return nil
+	})
+}
+
+func tag_list(c *cli.Context) error {
+	init_engine(c)
+	defer close_engine()
+
+	counts, err := facet_terms("Tags", c.Int("size"))
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if len(counts) == 0 {
+		logrus.Info("未找到标签")
+		return nil
+	}
+	for _, term := range counts {
+		fmt.Printf("%v\t%v\n", term.Term, term.Count)
+	}
+	return nil
+}
+
+func set_collection(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "collection")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	return update_doc(c.Args().First(), func(doc *Doc) error {
+		doc.Collection = strings.TrimSpace(c.Args().Get(1))
+		logrus.Infof("collection of %v: %v", doc.Id, doc.Collection)
+		return nil
+	})
+}
+
+func edit_note(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "note")
+	}
+	init_engine(c)
+	defer close_engine()
+
+	doc, err := get_doc(c.Args().First())
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if doc == nil {
+		logrus.Error("未找到数据")
+		return nil
+	}
+
+	if c.NArg() > 1 {
+		doc.Note = strings.Join(c.Args().Tail(), " ")
+	} else {
+		note, err := edit_in_editor(doc.Note)
+		if err != nil {
+			logrus.Error(err)
+			return err
+		}
+		doc.Note = note
+	}
+
+	if err := save_doc(doc); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	logrus.Infof("note of %v saved", doc.Id)
+	return nil
+}
+
+func star(c *cli.Context) error {
+	return set_starred(c, true)
+}
+
+func unstar(c *cli.Context) error {
+	return set_starred(c, false)
+}
+
+func set_starred(c *cli.Context, starred bool) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, c.Command.Name)
+	}
+	init_engine(c)
+	defer close_engine()
+
+	for _, id := range c.Args() {
+		if err := update_doc(id, func(doc *Doc) error {
+			doc.Starred = starred
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update_doc loads doc by id, applies fn and saves it back, nothing is saved if fn fails
+func update_doc(id string, fn func(doc *Doc) error) error {
+	doc, err := get_doc(id)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if doc == nil {
+		logrus.Errorf("doc %v not found", id)
+		return nil
+	}
+	if err := fn(doc); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	if err := save_doc(doc); err != nil {
+		logrus.Error(err)
+		return err
+	}
+	return nil
+}
+
+// facet_terms counts terms of field over all docs
+func facet_terms(field string, size int) ([]termcount, error) {
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	req.AddFacet(field, bleve.NewFacetRequest(field, size))
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	counts := []termcount{}
+	if facet, ok := res.Facets[field]; ok {
+		for _, term := range facet.Terms {
+			counts = append(counts, termcount{Term: term.Term, Count: term.Count})
+		}
+	}
+	return counts, nil
+}
+
+type termcount struct {
+	Term  string
+	Count int
+}
+
+func normalize_tag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func has_tag(doc *Doc, tag string) bool {
+	for _, t := range doc.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tags_label formats tags for output
+func tags_label(tags interface{}) string {
+	var list []string
+	switch v := tags.(type) {
+	case string:
+		list = []string{v}
+	case []string:
+		list = v
+	case []interface{}:
+		for _, t := range v {
+			list = append(list, fmt.Sprint(t))
+		}
+	}
+	label := ""
+	for _, t := range list {
+		if t != "" {
+			label += " #" + t
+		}
+	}
+	return label
+}
+
+// edit_in_editor opens text in $EDITOR and returns the edited text
+func edit_in_editor(text string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := ioutil.TempFile("", "readengine")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve/search/query"
+)
+
+func TestSplitFilters(t *testing.T) {
+	keyword, filters := split_filters("worker pool tag:Go collection:k8s starred:true http://x")
+	if keyword != "worker pool http://x" {
+		t.Errorf("unexpected keyword %q", keyword)
+	}
+	if len(filters) != 3 {
+		t.Fatalf("expect 3 filters, got %v", len(filters))
+	}
+	if q, ok := filters[0].(*query.TermQuery); !ok || q.Term != "go" || q.Field() != "Tags" {
+		t.Errorf("unexpected tag filter %+v", filters[0])
+	}
+	if q, ok := filters[1].(*query.TermQuery); !ok || q.Term != "k8s" || q.Field() != "Collection" {
+		t.Errorf("unexpected collection filter %+v", filters[1])
+	}
+}
+
+func TestSplitFiltersInPhrase(t *testing.T) {
+	keyword, filters := split_filters(`"about tag:go syntax" tag:rust`)
+	if keyword != `"about tag:go syntax"` {
+		t.Errorf("unexpected keyword %q", keyword)
+	}
+	if len(filters) != 1 {
+		t.Errorf("expect 1 filter, got %v", len(filters))
+	}
+}
+
+func TestSplitFiltersQuoted(t *testing.T) {
+	keyword, filters := split_filters(`go author:"Rob Pike" site:https://www.Medium.com/x month:2018-03 month:spring`)
+	if keyword != "go month:spring" {
+		t.Errorf("unexpected keyword %q", keyword)
+	}
+	if len(filters) != 3 {
+		t.Fatalf("expect 3 filters, got %v", len(filters))
+	}
+	if q, ok := filters[0].(*query.TermQuery); !ok || q.Term != "Rob Pike" || q.Field() != "Author" {
+		t.Errorf("unexpected author filter %+v", filters[0])
+	}
+	if q, ok := filters[1].(*query.TermQuery); !ok || q.Term != "medium.com" || q.Field() != "Domain" {
+		t.Errorf("unexpected site filter %+v", filters[1])
+	}
+}